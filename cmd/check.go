@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	klog "k8s.io/klog/v2"
+
+	"github.com/S-Chan/plio/config"
+	"github.com/S-Chan/plio/history"
+	"github.com/S-Chan/plio/integration"
+	"github.com/S-Chan/plio/output"
+)
+
+// checkOptions holds the flags of the check command
+type checkOptions struct {
+	aws        integration.Options
+	timeout    time.Duration
+	format     string
+	failOn     string
+	configPath string
+	waiverFile string
+	// snapshotPath, if set, is the file the collected snapshot is written to
+	snapshotPath string
+	// historyPath, if set, is the history database results are recorded to
+	historyPath string
+	// organization checks the member accounts of the AWS Organization, as
+	// configured by org
+	organization bool
+	org          integration.OrganizationOptions
+}
+
+func newCheckCmd() *cobra.Command {
+	var o checkOptions
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check if your AWS infra is SOC2 compliant",
+		Long: `Check if your AWS infra is SOC2 compliant.
+
+Options are read from the config file given by --config, or from ` + config.DefaultFile + `
+in the working directory if it exists. Flags set on the command line take
+precedence over the config file.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			o.load(cmd)
+			formatter, failPolicy := o.reportOptions()
+
+			ctx, cancel := o.context(cmd)
+			defer cancel()
+
+			aws, err := integration.NewAWS(ctx, o.aws)
+			if err != nil {
+				exitf("AWS integration creation failed: %v", err)
+			}
+			snapshot, err := aws.Collect(ctx)
+			if err != nil {
+				exitf("AWS check failed: %v", err)
+			}
+			if o.snapshotPath != "" {
+				if err := writeSnapshot(o.snapshotPath, snapshot); err != nil {
+					exitf("writing snapshot failed: %v", err)
+				}
+			}
+			res := aws.Evaluate(snapshot)
+			o.record(snapshot.CreatedAt, res)
+			o.report(cmd, formatter, failPolicy, res)
+		},
+	}
+
+	addConfigFlag(cmd, &o)
+	addAWSFlags(cmd, &o)
+	addRuleFlags(cmd, &o)
+	addReportFlags(cmd, &o)
+	addHistoryFlag(cmd, &o)
+	cmd.Flags().StringVar(&o.snapshotPath, "snapshot", "",
+		"file to also write the collected inventory to, as evidence for the report (see plio collect)")
+	return cmd
+}
+
+// load applies the config file and the waiver file to o, exiting if either
+// is invalid
+func (o *checkOptions) load(cmd *cobra.Command) {
+	path, err := config.Find(o.configPath)
+	if err != nil {
+		exitf("finding config file failed: %v", err)
+	}
+	if path != "" {
+		cfg, err := config.Load(path)
+		if err != nil {
+			exitf("invalid config file: %v", err)
+		}
+		applyConfig(cmd, cfg, o)
+	}
+	if o.waiverFile != "" {
+		waivers, err := config.LoadWaivers(o.waiverFile)
+		if err != nil {
+			exitf("invalid waiver file: %v", err)
+		}
+		o.aws.Waivers = append(o.aws.Waivers, waivers...)
+	}
+
+	if o.organization {
+		o.aws.Organization = &o.org
+	}
+}
+
+// reportOptions returns the formatter and fail policy selected by o, exiting
+// if either is invalid
+func (o *checkOptions) reportOptions() (output.Formatter, integration.FailPolicy) {
+	formatter, err := output.Lookup(o.format)
+	if err != nil {
+		exitf("%v", err)
+	}
+	failPolicy, err := integration.ParseFailPolicy(o.failOn)
+	if err != nil {
+		exitf("invalid --fail-on: %v", err)
+	}
+	return formatter, failPolicy
+}
+
+// context returns the context of cmd, bounded by o's timeout if set
+func (o *checkOptions) context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if o.timeout > 0 {
+		return context.WithTimeout(cmd.Context(), o.timeout)
+	}
+	return context.WithCancel(cmd.Context())
+}
+
+// record records res in the history database, if any, as a scan of the
+// configuration collected at createdAt, exiting if it fails. Resources checked
+// more than once, e.g. organization trails, are recorded once.
+func (o *checkOptions) record(createdAt time.Time, res []integration.Result) {
+	if o.historyPath == "" {
+		return
+	}
+	store, err := history.Open(o.historyPath)
+	if err != nil {
+		exitf("opening scan history failed: %v", err)
+	}
+	defer store.Close()
+	id, err := store.Record(createdAt, integration.MergeResults(res))
+	if err != nil {
+		exitf("recording scan history failed: %v", err)
+	}
+	klog.Infof("recorded scan %d in %s", id, o.historyPath)
+}
+
+// report writes the report of res and exits with the matching exit code if
+// the scan fails
+func (o *checkOptions) report(cmd *cobra.Command, formatter output.Formatter, failPolicy integration.FailPolicy, res []integration.Result) {
+	report := integration.NewReport(res, o.aws.Waivers)
+	if err := formatter.Format(cmd.OutOrStdout(), report); err != nil {
+		exitf("result serialization failed: %v", err)
+	}
+
+	if code := exitCode(report, failPolicy); code != exitCompliant {
+		exit(code)
+	}
+}
+
+// addConfigFlag adds the --config flag
+func addConfigFlag(cmd *cobra.Command, o *checkOptions) {
+	cmd.Flags().StringVar(&o.configPath, "config", "",
+		fmt.Sprintf("path to the config file (default: %s if it exists)", config.DefaultFile))
+}
+
+// addAWSFlags adds the flags selecting the AWS accounts, credentials,
+// endpoints and regions to collect from
+func addAWSFlags(cmd *cobra.Command, o *checkOptions) {
+	cmd.Flags().BoolVar(&o.organization, "organization", false,
+		"check every active member account of the caller's AWS Organization instead of the caller's account")
+	cmd.Flags().StringVar(&o.org.RoleName, "organization-role", integration.DefaultOrganizationRole,
+		"name of the audit role assumed in every member account")
+	cmd.Flags().StringVar(&o.org.ExternalID, "organization-external-id", "",
+		"external ID passed when assuming the audit role in member accounts")
+	cmd.Flags().StringVar(&o.aws.Credentials.Profile, "profile", "", "shared config profile to use (default: the SDK default credential chain)")
+	cmd.Flags().StringVar(&o.aws.Credentials.RoleARN, "role-arn", "", "ARN of a role to assume for the scan")
+	cmd.Flags().StringVar(&o.aws.Credentials.ExternalID, "external-id", "", "external ID passed when assuming --role-arn")
+	cmd.Flags().StringVar(&o.aws.Credentials.MFASerial, "mfa-serial", "",
+		"serial number or ARN of the MFA device required to assume --role-arn; the code is read from stdin")
+	cmd.Flags().StringVar(&o.aws.Credentials.SessionName, "session-name", "plio", "role session name used when assuming --role-arn")
+	cmd.Flags().DurationVar(&o.aws.Credentials.Duration, "duration", 0,
+		"lifetime of assumed role credentials, e.g. 1h (default: the STS default of 15m)")
+	cmd.Flags().StringVar(&o.aws.Credentials.WebIdentityTokenFile, "web-identity-token-file", "",
+		"file containing an OIDC token, e.g. from CI, exchanged for the credentials of --role-arn")
+	cmd.Flags().StringVar(&o.aws.Endpoints.URL, "endpoint-url", "",
+		"endpoint URL of every AWS API, e.g. http://localhost:4566 for LocalStack")
+	cmd.Flags().StringVar(&o.aws.Region, "region", "us-east-1", "AWS region used for global API calls")
+	cmd.Flags().StringSliceVar(&o.aws.Regions, "regions", nil,
+		"comma-separated regions checked by regional rules (default: every enabled region)")
+	cmd.Flags().IntVar(&o.aws.Parallelism, "parallelism", 8, "maximum number of concurrent AWS API workers")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", 0, "maximum duration of the scan, e.g. 10m (0 means no timeout)")
+	cmd.Flags().StringVar(&o.aws.RecordDir, "record", "", "directory to record every AWS API request and response to")
+	cmd.Flags().StringVar(&o.aws.ReplayDir, "replay", "", "directory of recorded AWS API responses to check instead of AWS")
+	cmd.MarkFlagsMutuallyExclusive("record", "replay")
+}
+
+// addServicesFlag adds the --services flag
+func addServicesFlag(cmd *cobra.Command, o *checkOptions) {
+	cmd.Flags().StringSliceVar(&o.aws.Filter.Services, "services", nil,
+		fmt.Sprintf("comma-separated services to check, any of %s (default: every service)",
+			strings.Join(integration.Services, ", ")))
+}
+
+// addRuleFlags adds the flags selecting the rules and resources checked, and
+// the waivers applied to them
+func addRuleFlags(cmd *cobra.Command, o *checkOptions) {
+	cmd.Flags().StringSliceVar(&o.aws.Filter.Rules, "rules", nil,
+		"comma-separated rule IDs or glob patterns to check, e.g. AWS-VPC-* (default: every rule)")
+	cmd.Flags().StringSliceVar(&o.aws.Filter.SkipRules, "skip-rules", nil,
+		"comma-separated rule IDs or glob patterns not to check")
+	addServicesFlag(cmd, o)
+	cmd.Flags().StringToStringVar(&o.aws.Tags.Include, "include-tags", nil,
+		"comma-separated key=value tags a resource must all have to be checked; values may be glob patterns, "+
+			"e.g. environment=production,compliance-scope=*")
+	cmd.Flags().StringToStringVar(&o.aws.Tags.Exclude, "exclude-tags", nil,
+		"comma-separated key=value tags excluding any resource that has one of them; values may be glob patterns")
+	cmd.Flags().StringVar(&o.waiverFile, "waivers", "", "path to a YAML file of waivers accepting known non-compliant resources")
+}
+
+// addHistoryFlag adds the --history flag
+func addHistoryFlag(cmd *cobra.Command, o *checkOptions) {
+	cmd.Flags().StringVar(&o.historyPath, "history", "",
+		"SQLite database to record the results of the scan to, for plio history")
+}
+
+// addReportFlags adds the flags selecting the report format and which
+// findings fail the scan
+func addReportFlags(cmd *cobra.Command, o *checkOptions) {
+	cmd.Flags().StringVarP(&o.format, "output", "o", "json",
+		fmt.Sprintf("output format, one of %s", strings.Join(output.Names(), ", ")))
+	cmd.Flags().StringVar(&o.failOn, "fail-on", "",
+		"comma-separated severity threshold and/or rule IDs whose non-compliant findings fail the scan, "+
+			"e.g. high or AWS-S3-001,AWS-IAM-003 (default: any non-compliant finding)")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/S-Chan/plio/config"
+	"github.com/S-Chan/plio/integration"
+)
+
+func newCollectCmd() *cobra.Command {
+	var o checkOptions
+
+	cmd := &cobra.Command{
+		Use:   "collect",
+		Short: "Collect a snapshot of your AWS configuration to evaluate later",
+		Long: `Collect a snapshot of your AWS configuration to evaluate later.
+
+The snapshot holds the AWS API responses every rule is evaluated against, so
+that "plio evaluate" can check it offline. Only the services of the rules
+selected by ` + config.DefaultFile + ` or --services are collected.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			o.load(cmd)
+
+			ctx, cancel := o.context(cmd)
+			defer cancel()
+
+			aws, err := integration.NewAWS(ctx, o.aws)
+			if err != nil {
+				exitf("AWS integration creation failed: %v", err)
+			}
+			snapshot, err := aws.Collect(ctx)
+			if err != nil {
+				exitf("AWS collection failed: %v", err)
+			}
+
+			if o.snapshotPath == "" {
+				err = snapshot.Write(cmd.OutOrStdout())
+			} else {
+				err = writeSnapshot(o.snapshotPath, snapshot)
+			}
+			if err != nil {
+				exitf("writing snapshot failed: %v", err)
+			}
+		},
+	}
+
+	addConfigFlag(cmd, &o)
+	addAWSFlags(cmd, &o)
+	addServicesFlag(cmd, &o)
+	cmd.Flags().StringVarP(&o.snapshotPath, "output", "o", "", "file to write the snapshot to (default: stdout)")
+	return cmd
+}
+
+// writeSnapshot writes s to the file at path
+func writeSnapshot(path string, s *integration.Snapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
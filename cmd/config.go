@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/S-Chan/plio/config"
+)
+
+// applyConfig copies every option set in cfg into o, unless the matching flag
+// was set on the command line
+func applyConfig(cmd *cobra.Command, cfg *config.Config, o *checkOptions) {
+	unset := func(flag string) bool {
+		return !cmd.Flags().Changed(flag)
+	}
+
+	if cfg.Organization != nil {
+		o.organization = true
+		if cfg.Organization.RoleName != "" && unset("organization-role") {
+			o.org.RoleName = cfg.Organization.RoleName
+		}
+		if cfg.Organization.ExternalID != "" && unset("organization-external-id") {
+			o.org.ExternalID = cfg.Organization.ExternalID
+		}
+	}
+	if cfg.Endpoints.URL != "" && unset("endpoint-url") {
+		o.aws.Endpoints.URL = cfg.Endpoints.URL
+	}
+	if cfg.Region != "" && unset("region") {
+		o.aws.Region = cfg.Region
+	}
+	if len(cfg.Regions) > 0 && unset("regions") {
+		o.aws.Regions = cfg.Regions
+	}
+	if len(cfg.Rules.Enabled) > 0 && unset("rules") {
+		o.aws.Filter.Rules = cfg.Rules.Enabled
+	}
+	if len(cfg.Rules.Disabled) > 0 && unset("skip-rules") {
+		o.aws.Filter.SkipRules = cfg.Rules.Disabled
+	}
+	if len(cfg.Services) > 0 && unset("services") {
+		o.aws.Filter.Services = cfg.Services
+	}
+	if len(cfg.Tags.Include) > 0 && unset("include-tags") {
+		o.aws.Tags.Include = cfg.Tags.Include
+	}
+	if len(cfg.Tags.Exclude) > 0 && unset("exclude-tags") {
+		o.aws.Tags.Exclude = cfg.Tags.Exclude
+	}
+	if cfg.Parallelism > 0 && unset("parallelism") {
+		o.aws.Parallelism = cfg.Parallelism
+	}
+	if cfg.Timeout > 0 && unset("timeout") {
+		o.timeout = time.Duration(cfg.Timeout)
+	}
+	if cfg.Output.Format != "" && unset("output") {
+		o.format = cfg.Output.Format
+	}
+	if cfg.FailOn != "" && unset("fail-on") {
+		o.failOn = cfg.FailOn
+	}
+	if cfg.HistoryFile != "" && unset("history") {
+		o.historyPath = cfg.HistoryFile
+	}
+
+	// These can only be set in the config file.
+	o.aws.Accounts = cfg.AccountIDs()
+	o.aws.Params = cfg.Parameters
+	o.aws.Endpoints.Services = cfg.Endpoints.Services
+	o.aws.Waivers = cfg.Waivers
+	if cfg.WaiverFile != "" && unset("waivers") {
+		o.waiverFile = cfg.WaiverFile
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/S-Chan/plio/config"
+)
+
+func TestApplyConfig(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+version: 1
+region: eu-west-1
+regions: [eu-west-1]
+rules:
+  enabled: ["AWS-VPC-*"]
+  disabled: [AWS-VPC-002]
+output:
+  format: markdown
+fail_on: high
+parallelism: 4
+timeout: 10m
+history_file: plio.db
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var o checkOptions
+	cmd := &cobra.Command{}
+	addAWSFlags(cmd, &o)
+	addRuleFlags(cmd, &o)
+	addReportFlags(cmd, &o)
+	addHistoryFlag(cmd, &o)
+	// --parallelism is set to its default value, which still takes
+	// precedence.
+	if err := cmd.Flags().Parse([]string{"--region", "us-west-2", "--rules", "AWS-S3-*", "-o", "csv", "--parallelism", "8"}); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(cmd, cfg, &o)
+
+	for _, tt := range []struct {
+		option    string
+		got, want interface{}
+	}{
+		{"region", o.aws.Region, "us-west-2"},
+		{"regions", o.aws.Regions, []string{"eu-west-1"}},
+		{"rules", o.aws.Filter.Rules, []string{"AWS-S3-*"}},
+		{"skipped rules", o.aws.Filter.SkipRules, []string{"AWS-VPC-002"}},
+		{"output format", o.format, "csv"},
+		{"fail policy", o.failOn, "high"},
+		{"parallelism", o.aws.Parallelism, 8},
+		{"timeout", o.timeout, 10 * time.Minute},
+		{"history", o.historyPath, "plio.db"},
+	} {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.option, tt.got, tt.want)
+		}
+	}
+}
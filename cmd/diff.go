@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	klog "k8s.io/klog/v2"
+
+	"github.com/S-Chan/plio/config"
+	"github.com/S-Chan/plio/history"
+	"github.com/S-Chan/plio/integration"
+	"github.com/S-Chan/plio/output"
+)
+
+func newDiffCmd() *cobra.Command {
+	var (
+		o      checkOptions
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff BASE HEAD",
+		Short: "Compare the results of two scans",
+		Long: `Compare the results of two scans: the findings that are new, fixed or
+persisting in HEAD, the resources that appeared or disappeared, and the rules
+whose pass rate changed. Results are matched by rule ID and resource.
+
+BASE and HEAD are either JSON reports written by "plio check -o json", or the
+IDs of scans recorded in the history database given by --history or the
+history_file of the config file (` + config.DefaultFile + ` by default). Prefix a
+report whose file name is a number with ./ to read it as a file.
+
+diff exits with 1 if new findings fail the scan under --fail-on.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			o.load(cmd)
+			failPolicy, err := integration.ParseFailPolicy(o.failOn)
+			if err != nil {
+				exitf("invalid --fail-on: %v", err)
+			}
+
+			base, err := o.loadResults(args[0])
+			if err != nil {
+				exitf("reading %s failed: %v", args[0], err)
+			}
+			head, err := o.loadResults(args[1])
+			if err != nil {
+				exitf("reading %s failed: %v", args[1], err)
+			}
+
+			diff := integration.NewDiff(base, head)
+			if err := output.FormatDiff(cmd.OutOrStdout(), format, diff); err != nil {
+				exitf("writing diff failed: %v", err)
+			}
+
+			var failures int
+			for _, res := range diff.NewFindings {
+				if failPolicy.Fails(res) {
+					failures++
+				}
+			}
+			if failures > 0 {
+				klog.Infof("%d new findings fail the scan", failures)
+				exit(exitNonCompliant)
+			}
+		},
+	}
+
+	addConfigFlag(cmd, &o)
+	cmd.Flags().StringVar(&o.historyPath, "history", "", "SQLite database the scans BASE and HEAD were recorded to")
+	cmd.Flags().StringVarP(&format, "output", "o", "text",
+		fmt.Sprintf("output format, one of %s", strings.Join(output.DiffFormats, ", ")))
+	cmd.Flags().StringVar(&o.failOn, "fail-on", "",
+		"comma-separated severity threshold and/or rule IDs whose new findings fail the diff, "+
+			"e.g. high or AWS-S3-001,AWS-IAM-003 (default: any new finding)")
+	return cmd
+}
+
+// loadResults returns the results of scan, the ID of a scan in the history
+// database or the path of a JSON report
+func (o *checkOptions) loadResults(scan string) ([]integration.Result, error) {
+	id, err := strconv.ParseInt(scan, 10, 64)
+	if err != nil {
+		return readReportResults(scan)
+	}
+	if o.historyPath == "" {
+		return nil, fmt.Errorf("no history database for scan %d, set --history or history_file in the config file", id)
+	}
+	store, err := history.Open(o.historyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.Results(id)
+}
+
+// readReportResults reads the results of the JSON report at path
+func readReportResults(path string) ([]integration.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Every report has a summary, unlike the other JSON plio writes.
+	var report struct {
+		Summary *integration.Summary `json:"summary"`
+		Results []integration.Result `json:"results"`
+	}
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, fmt.Errorf("not a JSON report: %w", err)
+	}
+	if report.Summary == nil {
+		return nil, errors.New("not a JSON report written by plio check -o json")
+	}
+	return report.Results, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/S-Chan/plio/config"
+	"github.com/S-Chan/plio/integration"
+)
+
+func newEvaluateCmd() *cobra.Command {
+	var o checkOptions
+
+	cmd := &cobra.Command{
+		Use:   "evaluate SNAPSHOT",
+		Short: "Check if a snapshot collected by plio collect is SOC2 compliant",
+		Long: `Check if a snapshot collected by "plio collect" is SOC2 compliant, without
+calling AWS.
+
+Options are read from the config file given by --config, or from ` + config.DefaultFile + `
+in the working directory if it exists. Rules of services missing from the
+snapshot fail with an error.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			o.load(cmd)
+			formatter, failPolicy := o.reportOptions()
+
+			snapshot, err := readSnapshot(args[0])
+			if err != nil {
+				exitf("invalid snapshot: %v", err)
+			}
+			res, err := integration.Evaluate(snapshot, o.aws)
+			if err != nil {
+				exitf("evaluating snapshot failed: %v", err)
+			}
+			o.record(snapshot.CreatedAt, res)
+			o.report(cmd, formatter, failPolicy, res)
+		},
+	}
+
+	addConfigFlag(cmd, &o)
+	addRuleFlags(cmd, &o)
+	addReportFlags(cmd, &o)
+	addHistoryFlag(cmd, &o)
+	return cmd
+}
+
+// readSnapshot reads the snapshot file at path
+func readSnapshot(path string) (*integration.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return integration.ReadSnapshot(f)
+}
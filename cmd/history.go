@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/S-Chan/plio/config"
+	"github.com/S-Chan/plio/history"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var (
+		o            checkOptions
+		since, until string
+		format       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Report compliance over time from the scans recorded by --history",
+		Long: `Report compliance over time from the scans recorded by "plio check --history"
+or "plio evaluate --history": the pass rate of every service and rule in every
+scan, when each finding was first and last seen and when it was fixed, and
+the mean time to remediate findings.
+
+The history database is read from --history, or from the history_file of the
+config file given by --config or ` + config.DefaultFile + ` in the working directory.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			o.load(cmd)
+			if o.historyPath == "" {
+				exitf("no history database, set --history or history_file in the config file")
+			}
+			if format != "text" && format != "json" {
+				exitf("unknown output format %q, must be text or json", format)
+			}
+			from, err := parseDate(since)
+			if err != nil {
+				exitf("invalid --since: %v", err)
+			}
+			to, err := parseDate(until)
+			if err != nil {
+				exitf("invalid --until: %v", err)
+			}
+			if !to.IsZero() {
+				// --until is inclusive.
+				to = to.AddDate(0, 0, 1)
+			}
+
+			store, err := history.Open(o.historyPath)
+			if err != nil {
+				exitf("opening scan history failed: %v", err)
+			}
+			defer store.Close()
+			report, err := store.Report(from, to)
+			if err != nil {
+				exitf("reading scan history failed: %v", err)
+			}
+
+			switch format {
+			case "text":
+				err = writeHistory(cmd.OutOrStdout(), report)
+			case "json":
+				err = writeJSON(cmd.OutOrStdout(), report)
+			}
+			if err != nil {
+				exitf("writing history failed: %v", err)
+			}
+		},
+	}
+
+	addConfigFlag(cmd, &o)
+	cmd.Flags().StringVar(&o.historyPath, "history", "", "SQLite database the scans were recorded to")
+	cmd.Flags().StringVar(&since, "since", "", "first day of the observation period, e.g. 2024-01-01 (default: the first scan)")
+	cmd.Flags().StringVar(&until, "until", "", "last day of the observation period, e.g. 2024-12-31 (default: the last scan)")
+	cmd.Flags().StringVarP(&format, "output", "o", "text", "output format, one of text, json")
+	return cmd
+}
+
+// parseDate parses a YYYY-MM-DD date in UTC, returning the zero time for ""
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// writeHistory writes report to w as text
+func writeHistory(w io.Writer, report *history.Report) error {
+	var b strings.Builder
+	if len(report.Scans) == 0 {
+		fmt.Fprintln(&b, "No scans recorded in this period.")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	section := func(title, header string) {
+		fmt.Fprintf(tw, "%s\n\n%s\n", title, header)
+	}
+	end := func() {
+		tw.Flush()
+		fmt.Fprintln(&b)
+	}
+
+	section("Scans", "SCAN\tCOLLECTED AT\tACCOUNTS\tCOMPLIANT\tNON-COMPLIANT\tWAIVED\tERRORS")
+	for _, s := range report.Scans {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%d\t%d\n", s.ID, formatTime(s.CreatedAt),
+			strings.Join(s.Accounts, ", "), s.Compliant, s.NonCompliant, s.Waived, s.Errors)
+	}
+	end()
+
+	for _, trends := range []struct {
+		title, column string
+		trends        []history.Trend
+	}{
+		{"Compliance by service", "SERVICE", report.Services},
+		{"Compliance by rule", "RULE", report.Rules},
+	} {
+		section(trends.title, trends.column+"\tSCAN\tCOLLECTED AT\tPASSED\tPASS RATE")
+		for _, t := range trends.trends {
+			for _, p := range t.Points {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%d/%d\t%.1f%%\n",
+					t.Key, p.ScanID, formatTime(p.CreatedAt), p.Passed, p.Checked, 100*p.PassRate)
+			}
+		}
+		end()
+	}
+
+	section("Findings", "RULE\tRESOURCE\tFIRST SEEN\tLAST SEEN\tFIXED")
+	for _, f := range report.Findings {
+		fixed := "open"
+		if f.FixedAt != nil {
+			fixed = formatTime(*f.FixedAt)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			f.RuleID, f.Resource.ID(), formatTime(f.FirstSeen), formatTime(f.LastSeen), fixed)
+	}
+	end()
+
+	section("Mean time to remediate", "RULE\tFIXED\tMEAN")
+	for _, t := range report.Remediation {
+		rule := t.RuleID
+		if rule == "" {
+			rule = "all rules"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", rule, t.Fixed, formatDuration(t.Mean()))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatTime formats t in UTC to the minute
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+// formatDuration formats d in days, hours and minutes, e.g. 3d4h5m
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	return fmt.Sprintf("%dd%dh%dm", days, d/time.Hour, (d%time.Hour)/time.Minute)
+}
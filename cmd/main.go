@@ -1,8 +1,9 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
+	"os"
 
 	"github.com/spf13/cobra"
 	klog "k8s.io/klog/v2"
@@ -10,33 +11,55 @@ import (
 	"github.com/S-Chan/plio/integration"
 )
 
+// Process exit codes
+const (
+	// exitCompliant means no findings fail the scan
+	exitCompliant = 0
+	// exitNonCompliant means non-compliant findings fail the scan
+	exitNonCompliant = 1
+	// exitScanError means the scan could not run, or some rules could not
+	// be checked
+	exitScanError = 2
+)
+
 func main() {
 	var fs flag.FlagSet
 	klog.InitFlags(&fs)
-	defer klog.Flush()
 
 	rootCmd := &cobra.Command{
 		Use:   "plio",
 		Short: "plio checks if your infra is SOC2 compliant",
-		Run: func(cmd *cobra.Command, _ []string) {
-			aws, err := integration.NewAWS(cmd.Flag("region").Value.String())
-			if err != nil {
-				klog.Exitf("AWS integration creation failed: %v", err)
-			}
-			res, err := aws.Check()
-			if err != nil {
-				klog.Exitf("AWS check failed: %v", err)
-			}
-			// convert res to json and print out using command
-			jsonRes, err := json.Marshal(res)
-			if err != nil {
-				klog.Exitf("result serialization failed: %v", err)
-			}
-			cmd.Println(string(jsonRes))
-		},
 	}
+	rootCmd.PersistentFlags().AddGoFlagSet(&fs)
+	rootCmd.AddCommand(newCheckCmd(), newCollectCmd(), newEvaluateCmd(), newRemediateCmd(), newRulesCmd(), newHistoryCmd(), newDiffCmd())
+	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
+		exit(exitScanError)
+	}
+	exit(exitCompliant)
+}
+
+// exitCode returns the exit code of a scan with the given report. Rules that
+// could not be checked take precedence over findings failing the scan.
+func exitCode(report *integration.Report, failPolicy integration.FailPolicy) int {
+	if report.HasErrors() {
+		klog.Warningf("%d checks failed with errors", len(report.Errors))
+		return exitScanError
+	}
+	if failures := report.Failures(failPolicy); len(failures) > 0 {
+		klog.Infof("%d non-compliant findings fail the scan", len(failures))
+		return exitNonCompliant
+	}
+	return exitCompliant
+}
+
+// exitf logs a fatal error and exits with exitScanError
+func exitf(format string, args ...interface{}) {
+	klog.ErrorfDepth(1, format, args...)
+	exit(exitScanError)
+}
 
-	rootCmd.Flags().AddGoFlagSet(&fs)
-	rootCmd.Flags().String("region", "us-east-1", "AWS region to check")
-	rootCmd.Execute()
+// exit flushes logs and exits with code
+func exit(code int) {
+	klog.Flush()
+	os.Exit(code)
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func TestExitCode(t *testing.T) {
+	result := func(ruleID string, severity integration.Severity, status integration.Status) integration.Result {
+		return integration.Result{
+			Resource: integration.Resource{Type: "aws/s3-bucket", Name: "logs", AccountID: "111122223333"},
+			RuleID:   ruleID,
+			Severity: severity,
+			Status:   status,
+		}
+	}
+	compliant := result("AWS-S3-001", integration.SeverityMedium, integration.StatusCompliant)
+	finding := result("AWS-S3-001", integration.SeverityMedium, integration.StatusNonCompliant)
+	waived := result("AWS-IAM-006", integration.SeverityCritical, integration.StatusWaived)
+	failed := result("AWS-S3-002", integration.SeverityLow, integration.StatusError)
+
+	for _, tt := range []struct {
+		name    string
+		results []integration.Result
+		failOn  string
+		want    int
+	}{
+		{name: "no results", want: exitCompliant},
+		{name: "compliant", results: []integration.Result{compliant}, want: exitCompliant},
+		{name: "finding", results: []integration.Result{compliant, finding}, want: exitNonCompliant},
+		{name: "finding below the threshold", results: []integration.Result{finding}, failOn: "high", want: exitCompliant},
+		{name: "finding of a listed rule", results: []integration.Result{finding}, failOn: "high,AWS-S3-001", want: exitNonCompliant},
+		{name: "waived finding", results: []integration.Result{waived}, want: exitCompliant},
+		{name: "error", results: []integration.Result{failed}, want: exitScanError},
+		{name: "error and finding", results: []integration.Result{finding, failed}, want: exitScanError},
+		{name: "error and waived finding", results: []integration.Result{waived, failed}, want: exitScanError},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			failPolicy, err := integration.ParseFailPolicy(tt.failOn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := exitCode(integration.NewReport(tt.results, nil), failPolicy); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
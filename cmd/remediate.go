@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	klog "k8s.io/klog/v2"
+
+	"github.com/S-Chan/plio/config"
+	"github.com/S-Chan/plio/integration"
+)
+
+func newRemediateCmd() *cobra.Command {
+	var (
+		o      checkOptions
+		rem    integration.RemediateOptions
+		apply  bool
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "remediate",
+		Short: "Fix the non-compliant resources of remediable rules",
+		Long: `Fix the non-compliant resources of remediable rules.
+
+By default only the plan of changes is printed. --apply makes the changes,
+logging each one. Run "plio rules list" to see which rules can be remediated;
+--rules, --skip-rules and --services select among them.
+
+Options are read from the config file given by --config, or from ` + config.DefaultFile + `
+in the working directory if it exists. Flags set on the command line take
+precedence over the config file.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			o.load(cmd)
+			if format != "text" && format != "json" {
+				exitf("unknown output format %q, must be text or json", format)
+			}
+
+			ctx, cancel := o.context(cmd)
+			defer cancel()
+
+			aws, err := integration.NewAWS(ctx, o.aws)
+			if err != nil {
+				exitf("AWS integration creation failed: %v", err)
+			}
+			plan, err := aws.Plan(ctx, rem)
+			if err != nil {
+				exitf("AWS remediation planning failed: %v", err)
+			}
+
+			failed := 0
+			if apply {
+				for i := range plan.Actions {
+					act := &plan.Actions[i]
+					klog.Infof("%s: %s", act.Resource.ID(), act.Description)
+					if err := act.Apply(ctx); err != nil {
+						klog.Errorf("%s: %s failed: %v", act.Resource.ID(), act.Description, err)
+						failed++
+						continue
+					}
+					klog.Infof("%s: applied", act.Resource.ID())
+				}
+			}
+
+			switch format {
+			case "text":
+				err = writePlan(cmd.OutOrStdout(), plan, apply)
+			case "json":
+				err = writeJSON(cmd.OutOrStdout(), plan)
+			}
+			if err != nil {
+				exitf("writing plan failed: %v", err)
+			}
+
+			if len(plan.Errors) > 0 {
+				klog.Warningf("%d checks failed with errors", len(plan.Errors))
+				exit(exitScanError)
+			}
+			if failed > 0 {
+				klog.Warningf("%d of %d changes failed", failed, len(plan.Actions))
+				exit(exitScanError)
+			}
+		},
+	}
+
+	addConfigFlag(cmd, &o)
+	addAWSFlags(cmd, &o)
+	addRuleFlags(cmd, &o)
+	cmd.Flags().BoolVar(&apply, "apply", false, "make the planned changes instead of only printing them")
+	// Changes can neither be replayed nor should their calls be recorded.
+	cmd.MarkFlagsMutuallyExclusive("apply", "record")
+	cmd.MarkFlagsMutuallyExclusive("apply", "replay")
+	cmd.Flags().StringVar(&rem.FlowLogDestination, "flow-logs-destination", "",
+		"ARN of the S3 bucket, optionally followed by a prefix, that created VPC flow logs are delivered to "+
+			"(required to fix AWS-VPC-001)")
+	cmd.Flags().StringVarP(&format, "output", "o", "text", "output format, one of text, json")
+	return cmd
+}
+
+// writePlan writes the actions and errors of plan to w as text
+func writePlan(w io.Writer, plan *integration.Plan, applied bool) error {
+	var b strings.Builder
+	if len(plan.Actions) == 0 {
+		fmt.Fprintln(&b, "No changes to make.")
+	} else {
+		tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATUS\tRULE\tRESOURCE\tCHANGE")
+		for _, act := range plan.Actions {
+			change := act.Description
+			if act.Error != "" {
+				change += ": " + act.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", act.Status, act.RuleID, act.Resource.ID(), change)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if !applied {
+			fmt.Fprintf(&b, "\nDry run: %d changes planned, none made. Run with --apply to make them.\n", len(plan.Actions))
+		}
+	}
+
+	if len(plan.Errors) > 0 {
+		fmt.Fprintf(&b, "\n%d checks failed with errors, their resources may need changes not planned:\n", len(plan.Errors))
+		for _, e := range plan.Errors {
+			fmt.Fprintf(&b, "  %s %s: %s\n", e.RuleID, e.Resource.ID(), e.Error)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
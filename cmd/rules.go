@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// ruleSummary is a rule as listed by the rules list command
+type ruleSummary struct {
+	ID          string               `json:"id"`
+	Service     string               `json:"service"`
+	Severity    integration.Severity `json:"severity"`
+	Criteria    []string             `json:"criteria"`
+	Description string               `json:"description"`
+}
+
+// ruleExplanation is a rule as explained by the rules explain command
+type ruleExplanation struct {
+	ruleSummary
+	Rationale   string      `json:"rationale"`
+	Params      []ruleParam `json:"params,omitempty"`
+	APICalls    []string    `json:"api_calls"`
+	Permissions []string    `json:"permissions"`
+	Remediation string      `json:"remediation"`
+	// Remediable is whether plio remediate can fix violations
+	Remediable bool     `json:"remediable"`
+	References []string `json:"references"`
+}
+
+// ruleParam is a rule parameter as explained by the rules explain command
+type ruleParam struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     int    `json:"default"`
+}
+
+func newRulesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "List and explain the rules plio checks",
+	}
+	cmd.AddCommand(newRulesListCmd(), newRulesExplainCmd())
+	return cmd
+}
+
+func newRulesListCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List every rule plio checks",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			var rules []ruleSummary
+			for _, r := range integration.Rules() {
+				rules = append(rules, summarizeRule(r))
+			}
+
+			var err error
+			switch format {
+			case "table":
+				err = writeRuleTable(cmd.OutOrStdout(), rules)
+			case "json":
+				err = writeJSON(cmd.OutOrStdout(), rules)
+			default:
+				exitf("unknown output format %q, must be table or json", format)
+			}
+			if err != nil {
+				exitf("writing rules failed: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "output", "o", "table", "output format, one of table, json")
+	return cmd
+}
+
+func newRulesExplainCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "explain RULE_ID",
+		Short: "Explain why a rule matters, what it inspects and how to fix violations",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			r, ok := integration.LookupRule(args[0])
+			if !ok {
+				exitf("unknown rule %s, see plio rules list", args[0])
+			}
+			rule := explainRule(r)
+
+			var err error
+			switch format {
+			case "text":
+				err = writeRuleExplanation(cmd.OutOrStdout(), rule)
+			case "json":
+				err = writeJSON(cmd.OutOrStdout(), rule)
+			default:
+				exitf("unknown output format %q, must be text or json", format)
+			}
+			if err != nil {
+				exitf("writing rule failed: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "output", "o", "text", "output format, one of text, json")
+	return cmd
+}
+
+func summarizeRule(r integration.Rule) ruleSummary {
+	return ruleSummary{
+		ID:          r.ID,
+		Service:     r.Service,
+		Severity:    r.Severity,
+		Criteria:    r.Criteria,
+		Description: r.Title,
+	}
+}
+
+func explainRule(r integration.Rule) ruleExplanation {
+	e := ruleExplanation{
+		ruleSummary: summarizeRule(r),
+		Rationale:   r.Rationale,
+		APICalls:    r.APICalls,
+		Permissions: r.Permissions(),
+		Remediation: r.Remediation,
+		Remediable:  r.Remediable,
+		References:  r.References,
+	}
+	for _, p := range r.Params {
+		e.Params = append(e.Params, ruleParam{Name: p.Name, Description: p.Description, Default: p.Default})
+	}
+	return e
+}
+
+// writeRuleTable writes rules to w as an aligned table
+func writeRuleTable(w io.Writer, rules []ruleSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSERVICE\tSEVERITY\tSOC2 CRITERIA\tDESCRIPTION")
+	for _, r := range rules {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Service, r.Severity, strings.Join(r.Criteria, ", "), r.Description)
+	}
+	return tw.Flush()
+}
+
+// writeRuleExplanation writes r to w as text
+func writeRuleExplanation(w io.Writer, r ruleExplanation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n\n", r.ID, r.Description)
+	fmt.Fprintf(&b, "Service:        %s\n", r.Service)
+	fmt.Fprintf(&b, "Severity:       %s\n", r.Severity)
+	fmt.Fprintf(&b, "SOC2 criteria:  %s\n", strings.Join(r.Criteria, ", "))
+
+	section := func(title string, lines ...string) {
+		fmt.Fprintf(&b, "\n%s\n", title)
+		for _, line := range lines {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	section("Rationale", r.Rationale)
+	if len(r.Params) > 0 {
+		var params []string
+		for _, p := range r.Params {
+			params = append(params, fmt.Sprintf("%s (default %d): %s", p.Name, p.Default, p.Description))
+		}
+		section("Parameters", params...)
+	}
+	section("Inspects", r.APICalls...)
+	section("Required IAM permissions", r.Permissions...)
+	remediation := []string{r.Remediation}
+	if r.Remediable {
+		remediation = append(remediation, "", "plio remediate can make this fix, see plio remediate --help.")
+	}
+	section("Remediation", remediation...)
+	section("References", r.References...)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeJSON writes v to w as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,243 @@
+// Package config loads plio's YAML configuration file
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/S-Chan/plio/integration"
+	"github.com/S-Chan/plio/output"
+)
+
+// DefaultFile is the config file looked up in the working directory when no
+// path is given
+const DefaultFile = "plio.yaml"
+
+// Version is the only supported config file version
+const Version = 1
+
+// Config is the contents of a plio config file. Zero values mean "not set",
+// so command-line defaults apply.
+type Config struct {
+	// Version is the config file format version and must be 1
+	Version int `yaml:"version"`
+	// Accounts, if set, are the only AWS accounts plio may scan
+	Accounts []Account `yaml:"accounts"`
+	// Organization, if set, checks the member accounts of the AWS
+	// Organization. Accounts then selects the member accounts to check.
+	Organization *integration.OrganizationOptions `yaml:"organization"`
+	// Endpoints overrides the AWS API endpoints, e.g. to run against
+	// LocalStack
+	Endpoints integration.Endpoints `yaml:"endpoints"`
+	// Region is the region used for global API calls
+	Region string `yaml:"region"`
+	// Regions are the regions checked by regional rules
+	Regions []string `yaml:"regions"`
+	// Services are the services to check
+	Services []string `yaml:"services"`
+	// Rules selects rules by ID or glob pattern
+	Rules Rules `yaml:"rules"`
+	// Tags scopes the scan to resources by their AWS tags
+	Tags integration.TagFilter `yaml:"tags"`
+	// Parameters overrides rule parameters. It maps rule IDs to parameter
+	// names to values.
+	Parameters map[string]map[string]int `yaml:"parameters"`
+	// Output configures how the report is written
+	Output Output `yaml:"output"`
+	// FailOn is a severity threshold and/or rule IDs whose findings fail the
+	// scan, as accepted by --fail-on
+	FailOn string `yaml:"fail_on"`
+	// Parallelism is the maximum number of concurrent AWS API workers
+	Parallelism int `yaml:"parallelism"`
+	// Timeout is the maximum duration of the scan
+	Timeout Duration `yaml:"timeout"`
+	// Waivers accept the risk of known non-compliant resources
+	Waivers []integration.Waiver `yaml:"waivers"`
+	// WaiverFile is a waiver file whose waivers are used in addition to
+	// Waivers
+	WaiverFile string `yaml:"waiver_file"`
+	// HistoryFile is the SQLite database every scan's results are recorded
+	// to
+	HistoryFile string `yaml:"history_file"`
+}
+
+// Account is an AWS account plio may scan
+type Account struct {
+	// ID is the 12-digit account ID
+	ID string `yaml:"id"`
+	// Name is a human-readable name for the account
+	Name string `yaml:"name"`
+}
+
+// Rules selects the rules to check
+type Rules struct {
+	// Enabled, if set, are the only rules checked
+	Enabled []string `yaml:"enabled"`
+	// Disabled are rules that are never checked
+	Disabled []string `yaml:"disabled"`
+}
+
+// Output configures how the report is written
+type Output struct {
+	// Format is the name of the output format, e.g. markdown
+	Format string `yaml:"format"`
+}
+
+// Duration is a time.Duration written as a string such as 10m
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string such as 10m or 1h30m
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		// A *yaml.TypeError lets decoding continue, so that every problem
+		// in the file is reported at once.
+		return &yaml.TypeError{Errors: []string{
+			fmt.Sprintf("line %d: invalid duration %q, e.g. 10m or 1h30m", node.Line, s),
+		}}
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Find returns the config file to use: path if set, otherwise DefaultFile if
+// it exists in the working directory. It returns "" if there is no config
+// file.
+func Find(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if _, err := os.Stat(DefaultFile); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return DefaultFile, nil
+}
+
+// Load reads, parses and validates the config file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// The waiver and history files are relative to the config file, not the
+	// working directory.
+	if cfg.WaiverFile != "" && !filepath.IsAbs(cfg.WaiverFile) {
+		cfg.WaiverFile = filepath.Join(filepath.Dir(path), cfg.WaiverFile)
+	}
+	if cfg.HistoryFile != "" && !filepath.IsAbs(cfg.HistoryFile) {
+		cfg.HistoryFile = filepath.Join(filepath.Dir(path), cfg.HistoryFile)
+	}
+	return cfg, nil
+}
+
+// Parse parses and validates a config file. Unknown keys are rejected.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(&cfg)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == io.EOF:
+		err = nil
+	case errors.As(err, &typeErr):
+		// Decoding went on past the keys and values in error, so they are
+		// reported along with every other problem.
+	case err != nil:
+		return nil, err
+	}
+	if err := errors.Join(err, cfg.Validate()); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+var accountIDRe = regexp.MustCompile(`^\d{12}$`)
+
+// Validate checks that every value in c is valid, reporting all problems at
+// once
+func (c *Config) Validate() error {
+	var errs []error
+	addErr := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", field, err))
+	}
+
+	if c.Version != Version {
+		addErr("version", fmt.Errorf("unsupported version %d, must be %d", c.Version, Version))
+	}
+	for i, a := range c.Accounts {
+		if !accountIDRe.MatchString(a.ID) {
+			addErr(fmt.Sprintf("accounts[%d].id", i), fmt.Errorf("%q is not a 12-digit AWS account ID", a.ID))
+		}
+	}
+	if err := c.Endpoints.Validate(); err != nil {
+		addErr("endpoints", err)
+	}
+	for i, r := range c.Regions {
+		if r == "" {
+			addErr(fmt.Sprintf("regions[%d]", i), errors.New("region is empty"))
+		}
+	}
+	if _, err := integration.SelectRules(integration.RuleFilter{
+		Rules:     c.Rules.Enabled,
+		SkipRules: c.Rules.Disabled,
+		Services:  c.Services,
+	}); err != nil {
+		addErr("rules", err)
+	}
+	if err := c.Tags.Validate(); err != nil {
+		addErr("tags", err)
+	}
+	if err := integration.ValidateParams(c.Parameters); err != nil {
+		addErr("parameters", err)
+	}
+	if c.Output.Format != "" {
+		if _, err := output.Lookup(c.Output.Format); err != nil {
+			addErr("output.format", err)
+		}
+	}
+	if _, err := integration.ParseFailPolicy(c.FailOn); err != nil {
+		addErr("fail_on", err)
+	}
+	if c.Parallelism < 0 {
+		addErr("parallelism", fmt.Errorf("must not be negative, got %d", c.Parallelism))
+	}
+	if c.Timeout < 0 {
+		addErr("timeout", errors.New("must not be negative"))
+	}
+	for i, w := range c.Waivers {
+		if err := w.Validate(); err != nil {
+			addErr(fmt.Sprintf("waivers[%d]", i), err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// AccountIDs returns the IDs of c's accounts
+func (c *Config) AccountIDs() []string {
+	var ids []string
+	for _, a := range c.Accounts {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+version: 1
+accounts:
+  - id: "123456789012"
+    name: production
+region: eu-west-1
+regions: [eu-west-1, us-east-1]
+rules:
+  enabled: ["AWS-VPC-*"]
+  disabled: [AWS-VPC-002]
+tags:
+  include:
+    environment: production
+output:
+  format: markdown
+fail_on: high,AWS-S3-001
+parallelism: 4
+timeout: 1h30m
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := &Config{
+		Version:  1,
+		Accounts: []Account{{ID: "123456789012", Name: "production"}},
+		Region:   "eu-west-1",
+		Regions:  []string{"eu-west-1", "us-east-1"},
+		Rules:    Rules{Enabled: []string{"AWS-VPC-*"}, Disabled: []string{"AWS-VPC-002"}},
+		Tags: integration.TagFilter{
+			Include: map[string]string{"environment": "production"},
+		},
+		Output:      Output{Format: "markdown"},
+		FailOn:      "high,AWS-S3-001",
+		Parallelism: 4,
+		Timeout:     Duration(90 * time.Minute),
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Parse() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		yaml string
+		// errs are parts of the wanted error
+		errs []string
+	}{
+		{
+			name: "empty",
+			yaml: "",
+			errs: []string{"version: unsupported version 0, must be 1"},
+		},
+		{
+			name: "unknown field",
+			yaml: "version: 1\nregoin: us-east-1\n",
+			errs: []string{"field regoin not found"},
+		},
+		{
+			name: "unknown nested field",
+			yaml: "version: 1\noutput:\n  fromat: csv\n",
+			errs: []string{"field fromat not found"},
+		},
+		{
+			name: "bad version",
+			yaml: "version: 2\n",
+			errs: []string{"version: unsupported version 2, must be 1"},
+		},
+		{
+			name: "bad fail_on",
+			yaml: "version: 1\nfail_on: severe\n",
+			errs: []string{`fail_on: "severe" is neither a severity nor a known rule ID`},
+		},
+		{
+			name: "bad timeout",
+			yaml: "version: 1\ntimeout: 10 minutes\n",
+			errs: []string{`line 2: invalid duration "10 minutes"`},
+		},
+		{
+			name: "every problem at once",
+			yaml: "version: 2\nfail_on: high,low\ntimeout: soon\nparallelism: -1\naccounts:\n  - id: \"123\"\nunknown: true\n",
+			errs: []string{
+				"version: unsupported version 2, must be 1",
+				"fail_on: more than one severity threshold",
+				`invalid duration "soon"`,
+				"parallelism: must not be negative, got -1",
+				`accounts[0].id: "123" is not a 12-digit AWS account ID`,
+				"field unknown not found",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil {
+				t.Fatal("Parse() error = nil")
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Parse() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// WaiverFile is the contents of a waiver file, which keeps waivers apart from
+// the config so they can be reviewed and approved on their own
+type WaiverFile struct {
+	Waivers []integration.Waiver `yaml:"waivers"`
+}
+
+// LoadWaivers reads, parses and validates the waiver file at path
+func LoadWaivers(path string) ([]integration.Waiver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f WaiverFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var errs []error
+	for i, w := range f.Waivers {
+		if err := w.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("waivers[%d]: %w", i, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Waivers, nil
+}
@@ -4,7 +4,9 @@ go 1.21.1
 
 require (
 	github.com/aws/aws-sdk-go v1.49.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/spf13/cobra v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/klog/v2 v2.110.1
 )
 
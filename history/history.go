@@ -0,0 +1,245 @@
+// Package history stores the results of every scan in a local SQLite
+// database, so that compliance can be reported over time
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	// Registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// SchemaVersion is the only supported database schema version
+const SchemaVersion = 1
+
+// schema creates the tables of an empty database
+const schema = `
+CREATE TABLE scans (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE results (
+	scan_id       INTEGER NOT NULL REFERENCES scans(id) ON DELETE CASCADE,
+	account_id    TEXT NOT NULL,
+	rule_id       TEXT NOT NULL,
+	service       TEXT NOT NULL,
+	severity      TEXT NOT NULL,
+	resource_id   TEXT NOT NULL,
+	resource_type TEXT NOT NULL,
+	resource_name TEXT NOT NULL,
+	resource_arn  TEXT NOT NULL,
+	region        TEXT NOT NULL,
+	status        TEXT NOT NULL,
+	reason        TEXT NOT NULL
+);
+CREATE UNIQUE INDEX results_scan ON results (scan_id, rule_id, resource_id);
+CREATE INDEX results_finding ON results (rule_id, resource_id);
+`
+
+// Store is a scan history database
+type Store struct {
+	db *sql.DB
+}
+
+// Scan is a scan recorded in a Store
+type Scan struct {
+	ID int64 `json:"id"`
+	// CreatedAt is when the scanned configuration was collected
+	CreatedAt time.Time `json:"created_at"`
+	// Accounts are the IDs of the accounts checked, in ascending order
+	Accounts []string `json:"accounts"`
+	integration.Summary
+}
+
+// Open opens the history database at path, creating it if it does not exist
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate creates the schema of an empty database and rejects databases of
+// another schema version
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	switch version {
+	case SchemaVersion:
+		return nil
+	case 0:
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(schema); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	default:
+		return fmt.Errorf("unsupported history schema version %d, must be %d", version, SchemaVersion)
+	}
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores results as a new scan of the configuration collected at
+// createdAt and returns its ID. Results must have a distinct rule and
+// resource, e.g. combined by integration.MergeResults.
+func (s *Store) Record(createdAt time.Time, results []integration.Result) (int64, error) {
+	type resultKey struct{ ruleID, resourceID string }
+	seen := map[resultKey]bool{}
+	for _, r := range results {
+		k := resultKey{r.RuleID, r.Resource.ID()}
+		if seen[k] {
+			return 0, fmt.Errorf("%w: rule %s, resource %s", ErrDuplicateResult, r.RuleID, k.resourceID)
+		}
+		seen[k] = true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO scans (created_at) VALUES (?)", createdAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO results (scan_id, account_id, rule_id, service, severity,
+		resource_id, resource_type, resource_name, resource_arn, region, status, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, r := range results {
+		if _, err := stmt.Exec(id, r.Resource.AccountID, r.RuleID, r.Service, string(r.Severity),
+			r.Resource.ID(), r.Resource.Type, r.Resource.Name, r.Resource.ARN, r.Resource.Region,
+			string(r.Status), r.Reason); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// Scans returns the scans of configurations collected in [since, until),
+// oldest first. A zero since or until leaves that end of the period open.
+func (s *Store) Scans(since, until time.Time) ([]Scan, error) {
+	scans, err := s.scans(since, until)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scans {
+		results, err := s.Results(scans[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		scans[i].summarize(results)
+	}
+	return scans, nil
+}
+
+// scans returns the IDs and creation times of the scans in [since, until),
+// oldest first
+func (s *Store) scans(since, until time.Time) ([]Scan, error) {
+	query, args := "SELECT id, created_at FROM scans WHERE created_at >= ?", []interface{}{since.UTC()}
+	if !until.IsZero() {
+		query, args = query+" AND created_at < ?", append(args, until.UTC())
+	}
+	rows, err := s.db.Query(query+" ORDER BY created_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scans := []Scan{}
+	for rows.Next() {
+		var scan Scan
+		if err := rows.Scan(&scan.ID, &scan.CreatedAt); err != nil {
+			return nil, err
+		}
+		scans = append(scans, scan)
+	}
+	return scans, rows.Err()
+}
+
+// ErrDuplicateResult is returned by Record for results of a scan with the
+// same rule and resource
+var ErrDuplicateResult = errors.New("duplicate result")
+
+// ErrScanNotFound is returned for a scan ID that is not in the Store
+var ErrScanNotFound = errors.New("scan not found")
+
+// Results returns the results of the scan with the given ID, in the order
+// they were recorded
+func (s *Store) Results(scanID int64) ([]integration.Result, error) {
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM scans WHERE id = ?)", scanID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrScanNotFound, scanID)
+	}
+
+	rows, err := s.db.Query(`SELECT account_id, rule_id, service, severity, resource_type,
+		resource_name, resource_arn, region, status, reason
+		FROM results WHERE scan_id = ? ORDER BY rowid`, scanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []integration.Result{}
+	for rows.Next() {
+		var r integration.Result
+		if err := rows.Scan(&r.Resource.AccountID, &r.RuleID, &r.Service, &r.Severity, &r.Resource.Type,
+			&r.Resource.Name, &r.Resource.ARN, &r.Resource.Region, &r.Status, &r.Reason); err != nil {
+			return nil, err
+		}
+		r.Compliant = r.Status == integration.StatusCompliant
+		if rule, ok := integration.LookupRule(r.RuleID); ok {
+			r.Rule, r.Criteria = rule.Title, rule.Criteria
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// summarize sets the accounts and summary of scan from its results
+func (scan *Scan) summarize(results []integration.Result) {
+	report := integration.NewReport(results, nil)
+	scan.Summary = report.Summary
+	scan.Accounts = []string{}
+	for _, a := range report.Accounts {
+		scan.Accounts = append(scan.Accounts, a.AccountID)
+	}
+	sort.Strings(scan.Accounts)
+}
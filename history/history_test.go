@@ -0,0 +1,114 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// openTestStore opens an empty Store in a temporary directory
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// trailResult returns a result of rule for the organization trail as
+// checked in account
+func trailResult(rule, account string, status integration.Status) integration.Result {
+	return integration.Result{
+		RuleID:  rule,
+		Service: integration.ServiceCloudTrail,
+		Resource: integration.Resource{
+			Type:      "aws/cloudtrail",
+			Name:      "org-trail",
+			ARN:       "arn:aws:cloudtrail:us-east-1:111122223333:trail/org-trail",
+			AccountID: account,
+			Region:    "us-east-1",
+		},
+		Status:    status,
+		Compliant: status == integration.StatusCompliant,
+	}
+}
+
+func TestRecordRejectsDuplicateResults(t *testing.T) {
+	s := openTestStore(t)
+	results := []integration.Result{
+		trailResult("AWS-CT-001", "111122223333", integration.StatusNonCompliant),
+		trailResult("AWS-CT-001", "222233334444", integration.StatusCompliant),
+	}
+	if _, err := s.Record(time.Now(), results); !errors.Is(err, ErrDuplicateResult) {
+		t.Fatalf("Record() error = %v, want %v", err, ErrDuplicateResult)
+	}
+	scans, err := s.Scans(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scans) != 0 {
+		t.Errorf("Record() recorded %d scans, want none", len(scans))
+	}
+
+	if _, err := s.Record(time.Now(), integration.MergeResults(results)); err != nil {
+		t.Errorf("Record() of merged results error = %v", err)
+	}
+}
+
+func TestReportFindings(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	scans := [][]integration.Result{
+		{trailResult("AWS-CT-001", "111122223333", integration.StatusNonCompliant)},
+		{trailResult("AWS-CT-001", "111122223333", integration.StatusNonCompliant)},
+		{trailResult("AWS-CT-001", "111122223333", integration.StatusCompliant)},
+	}
+	for i, results := range scans {
+		if _, err := s.Record(start.Add(time.Duration(i)*24*time.Hour), results); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := s.Report(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 1 {
+		t.Fatalf("Report() findings = %+v, want 1", report.Findings)
+	}
+	f := report.Findings[0]
+	if !f.FirstSeen.Equal(start) || !f.LastSeen.Equal(start.Add(24*time.Hour)) {
+		t.Errorf("finding seen %v to %v, want %v to %v", f.FirstSeen, f.LastSeen, start, start.Add(24*time.Hour))
+	}
+	if d, ok := f.TimeToRemediate(); !ok || d != 48*time.Hour {
+		t.Errorf("TimeToRemediate() = %v, %v, want 48h, true", d, ok)
+	}
+}
+
+func TestFindingSetMergesResults(t *testing.T) {
+	fs := findingSet{findings: []Finding{}, open: map[findingKey]int{}}
+	first := Scan{ID: 1, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	second := Scan{ID: 2, CreatedAt: first.CreatedAt.Add(24 * time.Hour)}
+
+	// The trail is still non-compliant in the second scan, although one
+	// account found it compliant.
+	fs.add(first, []integration.Result{
+		trailResult("AWS-CT-001", "111122223333", integration.StatusNonCompliant),
+	})
+	fs.add(second, []integration.Result{
+		trailResult("AWS-CT-001", "111122223333", integration.StatusNonCompliant),
+		trailResult("AWS-CT-001", "222233334444", integration.StatusCompliant),
+	})
+
+	if len(fs.findings) != 1 {
+		t.Fatalf("findings = %+v, want 1", fs.findings)
+	}
+	if f := fs.findings[0]; f.FixedAt != nil || !f.LastSeen.Equal(second.CreatedAt) {
+		t.Errorf("finding = %+v, want open and last seen %v", f, second.CreatedAt)
+	}
+}
@@ -0,0 +1,280 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// Report is the compliance over time of the scans of an observation period
+type Report struct {
+	// Since and Until bound the observation period. They are nil if that
+	// end of the period is open.
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	// Scans are the scans of the period, oldest first
+	Scans []Scan `json:"scans"`
+	// Services and Rules are the compliance over time of every service and
+	// rule checked
+	Services []Trend `json:"services"`
+	Rules    []Trend `json:"rules"`
+	// Findings are every period a rule found a resource non-compliant,
+	// ordered by when they were first seen
+	Findings []Finding `json:"findings"`
+	// Remediation is the time taken to fix the findings of every rule, and
+	// of all rules
+	Remediation []RemediationTime `json:"remediation"`
+}
+
+// Trend is the compliance of a rule or service in every scan that checked it
+type Trend struct {
+	// Key is the rule ID or service
+	Key    string  `json:"key"`
+	Points []Point `json:"points"`
+}
+
+// Point is the compliance of a rule or service in one scan
+type Point struct {
+	ScanID    int64     `json:"scan_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Passed counts compliant results
+	Passed int `json:"passed"`
+	// Checked counts results that are not errors. Waived results are
+	// checked, but do not pass.
+	Checked int `json:"checked"`
+	// PassRate is Passed / Checked
+	PassRate float64 `json:"pass_rate"`
+}
+
+// Finding is a period during which a rule found a resource non-compliant or
+// waived
+type Finding struct {
+	RuleID   string               `json:"rule_id"`
+	Resource integration.Resource `json:"resource"`
+	// FirstSeen and LastSeen are when the first and last scans finding the
+	// resource non-compliant were collected
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// FixedAt is when the first later scan finding the resource compliant,
+	// or no longer finding it, was collected. It is nil if the finding is
+	// still open.
+	FixedAt *time.Time `json:"fixed_at,omitempty"`
+}
+
+// TimeToRemediate returns how long f was open before it was fixed, or false
+// if it is still open
+func (f Finding) TimeToRemediate() (time.Duration, bool) {
+	if f.FixedAt == nil {
+		return 0, false
+	}
+	return f.FixedAt.Sub(f.FirstSeen), true
+}
+
+// RemediationTime is the mean time to remediate the fixed findings of a rule
+type RemediationTime struct {
+	// RuleID is the rule whose findings were fixed, or empty for all rules
+	RuleID string `json:"rule_id,omitempty"`
+	// Fixed counts the fixed findings
+	Fixed int `json:"fixed"`
+	// MeanSeconds is the mean time to remediate them, in seconds
+	MeanSeconds float64 `json:"mean_seconds"`
+}
+
+// Mean returns the mean time to remediate
+func (t RemediationTime) Mean() time.Duration {
+	return time.Duration(t.MeanSeconds * float64(time.Second))
+}
+
+// Report returns the compliance over time of the scans of configurations
+// collected in [since, until). Findings already open before since are first
+// seen in the first scan of the period.
+func (s *Store) Report(since, until time.Time) (*Report, error) {
+	scans, err := s.scans(since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Scans: []Scan{}}
+	if !since.IsZero() {
+		report.Since = &since
+	}
+	if !until.IsZero() {
+		report.Until = &until
+	}
+	services, rules := trendSet{}, trendSet{}
+	findings := findingSet{findings: []Finding{}, open: map[findingKey]int{}}
+	for _, scan := range scans {
+		results, err := s.Results(scan.ID)
+		if err != nil {
+			return nil, err
+		}
+		scan.summarize(results)
+		report.Scans = append(report.Scans, scan)
+
+		services.add(scan, results, func(r integration.Result) string { return r.Service })
+		rules.add(scan, results, func(r integration.Result) string { return r.RuleID })
+		findings.add(scan, results)
+	}
+
+	report.Services = services.trends()
+	report.Rules = rules.trends()
+	report.Findings = findings.findings
+	report.Remediation = remediationTimes(findings.findings)
+	return report, nil
+}
+
+// trendSet builds the trends of the groups of results with the same key
+type trendSet map[string]*Trend
+
+// add adds a point for every group of the results of scan
+func (ts trendSet) add(scan Scan, results []integration.Result, key func(integration.Result) string) {
+	points := map[string]*Point{}
+	for _, r := range results {
+		if r.Status == integration.StatusError {
+			continue
+		}
+		k := key(r)
+		p, ok := points[k]
+		if !ok {
+			p = &Point{ScanID: scan.ID, CreatedAt: scan.CreatedAt}
+			points[k] = p
+		}
+		p.Checked++
+		if r.Status == integration.StatusCompliant {
+			p.Passed++
+		}
+	}
+
+	for k, p := range points {
+		p.PassRate = float64(p.Passed) / float64(p.Checked)
+		t, ok := ts[k]
+		if !ok {
+			t = &Trend{Key: k}
+			ts[k] = t
+		}
+		t.Points = append(t.Points, *p)
+	}
+}
+
+// trends returns the trends of ts ordered by key
+func (ts trendSet) trends() []Trend {
+	trends := []Trend{}
+	for _, t := range ts {
+		trends = append(trends, *t)
+	}
+	sort.Slice(trends, func(i, j int) bool { return trends[i].Key < trends[j].Key })
+	return trends
+}
+
+// findingKey identifies the results of a rule for a resource across scans
+type findingKey struct {
+	ruleID     string
+	resourceID string
+}
+
+// coverageKey identifies the results of a rule in an account
+type coverageKey struct {
+	ruleID    string
+	accountID string
+}
+
+// findingSet tracks findings across scans, oldest first
+type findingSet struct {
+	findings []Finding
+	// open maps the findings still open to their index in findings
+	open map[findingKey]int
+}
+
+// add updates the findings with the results of scan. An open finding is
+// fixed once its rule is checked in its account again without finding the
+// resource non-compliant. Rules that could not be checked leave their
+// findings open. Results of the same rule and resource are combined by their
+// worst status.
+func (fs *findingSet) add(scan Scan, results []integration.Result) {
+	results = integration.MergeResults(results)
+	checked := map[coverageKey]bool{}
+	statuses := map[findingKey]integration.Status{}
+	for _, r := range results {
+		if r.Status != integration.StatusError {
+			checked[coverageKey{r.RuleID, r.Resource.AccountID}] = true
+		}
+		statuses[findingKey{r.RuleID, r.Resource.ID()}] = r.Status
+	}
+
+	for k, i := range fs.open {
+		f := &fs.findings[i]
+		switch statuses[k] {
+		case integration.StatusNonCompliant, integration.StatusWaived:
+			f.LastSeen = scan.CreatedAt
+		case integration.StatusError:
+			// Whether the resource was fixed is unknown.
+		default:
+			if checked[coverageKey{f.RuleID, f.Resource.AccountID}] {
+				fixedAt := scan.CreatedAt
+				f.FixedAt = &fixedAt
+				delete(fs.open, k)
+			}
+		}
+	}
+
+	for _, r := range results {
+		if r.Status != integration.StatusNonCompliant && r.Status != integration.StatusWaived {
+			continue
+		}
+		k := findingKey{r.RuleID, r.Resource.ID()}
+		if _, ok := fs.open[k]; ok {
+			continue
+		}
+		fs.open[k] = len(fs.findings)
+		fs.findings = append(fs.findings, Finding{
+			RuleID:    r.RuleID,
+			Resource:  r.Resource,
+			FirstSeen: scan.CreatedAt,
+			LastSeen:  scan.CreatedAt,
+		})
+	}
+}
+
+// remediationTimes returns the mean time to remediate the fixed findings of
+// every rule, ordered by rule ID, followed by that of all rules
+func remediationTimes(findings []Finding) []RemediationTime {
+	type total struct {
+		fixed int
+		sum   time.Duration
+	}
+	byRule := map[string]*total{}
+	var all total
+	for _, f := range findings {
+		d, ok := f.TimeToRemediate()
+		if !ok {
+			continue
+		}
+		t, ok := byRule[f.RuleID]
+		if !ok {
+			t = &total{}
+			byRule[f.RuleID] = t
+		}
+		t.fixed++
+		t.sum += d
+		all.fixed++
+		all.sum += d
+	}
+
+	mean := func(ruleID string, t total) RemediationTime {
+		return RemediationTime{
+			RuleID:      ruleID,
+			Fixed:       t.fixed,
+			MeanSeconds: (t.sum / time.Duration(t.fixed)).Seconds(),
+		}
+	}
+	times := []RemediationTime{}
+	for ruleID, t := range byRule {
+		times = append(times, mean(ruleID, *t))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].RuleID < times[j].RuleID })
+	if all.fixed > 0 {
+		times = append(times, mean("", all))
+	}
+	return times
+}
@@ -1,158 +1,497 @@
 package integration
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudtrail"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 // AWS checks that the user's AWS infra is SOC2 compliant
 type AWS struct {
-	IAM        *IAM
-	S3         *S3
-	VPC        *VPC
-	CloudTrail *CloudTrail
+	// collector collects the inventory of a single account. It is nil when
+	// checking an organization.
+	collector *collector
+
+	account awsAccount
+	org     *organization
+	rules   []Rule
+	params  map[string]map[string]int
+	tags    TagFilter
+	waivers []Waiver
+}
+
+// Options configures the AWS integration
+type Options struct {
+	// Region is the region used for global API calls
+	Region string
+	// Credentials selects the AWS credentials. They are ignored when
+	// replaying.
+	Credentials CredentialOptions
+	// Endpoints overrides the AWS API endpoints, e.g. to run against
+	// LocalStack
+	Endpoints Endpoints
+	// Accounts, if set, are the IDs of the only AWS accounts that may be
+	// checked
+	Accounts []string
+	// Organization, if set, checks the member accounts of the caller's AWS
+	// Organization instead of the caller's account
+	Organization *OrganizationOptions
+	// Regions, if set, are the regions checked by regional rules. Otherwise
+	// every region enabled for the account is checked.
+	Regions []string
+	// Filter selects the rules that are checked
+	Filter RuleFilter
+	// Tags scopes the scan to resources by their tags
+	Tags TagFilter
+	// Params overrides rule parameters. It maps rule IDs to parameter names
+	// to values.
+	Params map[string]map[string]int
+	// Waivers mark matching non-compliant results as waived until they
+	// expire
+	Waivers []Waiver
+	// Parallelism is the maximum number of concurrent AWS API workers. It
+	// bounds the setup of organization accounts and the per-region and
+	// per-resource calls of every account; the few listing calls each
+	// service starts with are made outside it. Values less than 1 are
+	// treated as 1.
+	Parallelism int
+	// RecordDir, if set, is a directory every AWS API request and response
+	// is saved to. The calls of organization member accounts are saved to a
+	// subdirectory per account.
+	RecordDir string
+	// ReplayDir, if set, is a directory previously passed as RecordDir. AWS
+	// API calls are answered from it instead of the network.
+	ReplayDir string
 }
 
 // New returns a new AWS integration
-func NewAWS(region string) (*AWS, error) {
-	s := session.Must(session.NewSession(aws.NewConfig().WithRegion(region)))
+func NewAWS(ctx context.Context, opts Options) (*AWS, error) {
+	if opts.RecordDir != "" && opts.ReplayDir != "" {
+		return nil, errors.New("cannot both record and replay AWS API calls")
+	}
+
+	if err := opts.Endpoints.Validate(); err != nil {
+		return nil, err
+	}
 
-	ec2API := ec2.New(s)
-	regionOut, err := ec2API.DescribeRegions(nil)
+	cfg := aws.NewConfig().WithRegion(opts.Region)
+	if opts.Endpoints.URL != "" {
+		// Set on the session too, so that credentials are fetched from the
+		// same endpoint.
+		cfg = cfg.WithEndpoint(opts.Endpoints.URL).WithS3ForcePathStyle(true)
+	}
+	var (
+		s   *session.Session
+		err error
+	)
+	if opts.ReplayDir != "" {
+		// Recorded responses don't depend on credentials, and failed calls
+		// replay identically, so retrying them is pointless.
+		s, err = session.NewSession(cfg.
+			WithCredentials(credentials.NewStaticCredentials("replay", "replay", "")).
+			WithMaxRetries(0))
+	} else {
+		s, err = opts.Credentials.newSession(cfg)
+	}
 	if err != nil {
 		return nil, err
 	}
-	var regions []string
-	for _, r := range regionOut.Regions {
-		regions = append(regions, aws.StringValue(r.RegionName))
+
+	// Swap the transport only after the session is created, since the
+	// session may customize the default one, e.g. with AWS_CA_BUNDLE. The
+	// transport is swapped on a copy of the session, so that the STS calls
+	// fetching credentials, including those assuming the roles of
+	// organization member accounts, are kept out of recordings.
+	credsSession := s
+	var fixtures *fixtureDir
+	switch {
+	case opts.RecordDir != "":
+		if err := os.MkdirAll(opts.RecordDir, 0o755); err != nil {
+			return nil, err
+		}
+		next := s.Config.HTTPClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		fixtures = &fixtureDir{dir: opts.RecordDir, next: next}
+	case opts.ReplayDir != "":
+		fixtures = &fixtureDir{dir: opts.ReplayDir}
+		credsSession = nil
+	}
+	if fixtures != nil {
+		s = s.Copy(&aws.Config{HTTPClient: fixtures.client("")})
 	}
 
-	return &AWS{
-		IAM:        NewIAM(s),
-		S3:         NewS3(s),
-		VPC:        NewVPC(s, regions),
-		CloudTrail: NewCloudTrail(s, regions),
-	}, nil
+	clients := newSessionClients(s, credsSession, opts.Credentials.sessionName(), opts.Endpoints)
+	clients.fixtures = fixtures
+	return NewAWSWithClients(ctx, clients, opts)
 }
 
-// Check checks that the user's AWS infra is SOC2 compliant
-func (a *AWS) Check() ([]Result, error) {
-	iamRes, err := a.IAM.Check()
+// NewAWSWithClients returns a new AWS integration whose checks use clients
+func NewAWSWithClients(ctx context.Context, clients Clients, opts Options) (*AWS, error) {
+	rules, err := opts.rules()
 	if err != nil {
 		return nil, err
 	}
 
-	s3Res, err := a.S3.Check()
-	if err != nil {
-		return nil, err
+	// Every account shares one pool, so that Parallelism bounds the
+	// per-region and per-resource work of the whole scan rather than of
+	// each account. Collecting an account or a service waits on its
+	// workers, so that is not run on it itself.
+	pool := newWorkerPool(opts.Parallelism)
+	if opts.Organization != nil {
+		return newOrganizationAWS(ctx, clients, opts, rules, pool)
 	}
 
-	vpcRes, err := a.VPC.Check()
+	a, err := newAccountAWS(ctx, clients, opts, rules, pool)
 	if err != nil {
 		return nil, err
 	}
+	if len(opts.Accounts) > 0 && !contains(opts.Accounts, a.account.ID) {
+		return nil, fmt.Errorf("account %s is not one of the allowed accounts %v", a.account.ID, opts.Accounts)
+	}
+	return a, nil
+}
 
-	cloudTrailRes, err := a.CloudTrail.Check()
+// newAccountAWS returns an AWS integration that checks the account whose
+// credentials clients use
+func newAccountAWS(ctx context.Context, clients Clients, opts Options, rules []Rule, pool *workerPool) (*AWS, error) {
+	account, err := callerAccount(ctx, clients, opts.Region)
 	if err != nil {
 		return nil, err
 	}
 
-	return concatSlice(iamRes, s3Res, vpcRes, cloudTrailRes), nil
-}
-
-// IAM checks that the user's IAM infra is SOC2 compliant
-type IAM struct {
-	iamAPI *iam.IAM
-}
+	regions := opts.Regions
+	if len(regions) == 0 {
+		regionOut, err := clients.EC2(opts.Region).DescribeRegionsWithContext(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range regionOut.Regions {
+			regions = append(regions, aws.StringValue(r.RegionName))
+		}
+	}
 
-// NewIAM returns a new IAM integration
-func NewIAM(s *session.Session) *IAM {
-	return &IAM{iamAPI: iam.New(s)}
+	return &AWS{
+		collector: &collector{
+			clients:  clients,
+			account:  account,
+			region:   opts.Region,
+			regions:  regions,
+			services: ruleServices(rules),
+			pool:     pool,
+		},
+		account: account,
+		rules:   rules,
+		params:  opts.Params,
+		tags:    opts.Tags,
+		waivers: opts.Waivers,
+	}, nil
 }
 
-// Check checks that the user's IAM infra is SOC2 compliant
-func (i *IAM) Check() ([]Result, error) {
-	mfaRes, err := i.checkConsoleMFA()
+// rules validates the options that select and evaluate rules, and returns
+// the rules selected by opts.Filter
+func (opts Options) rules() ([]Rule, error) {
+	rules, err := SelectRules(opts.Filter)
 	if err != nil {
 		return nil, err
 	}
-
-	staleCredsRes, err := i.checkIAMUsersUnusedCreds()
-	if err != nil {
+	if err := ValidateParams(opts.Params); err != nil {
 		return nil, err
 	}
+	if err := opts.Tags.Validate(); err != nil {
+		return nil, err
+	}
+	for _, w := range opts.Waivers {
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
 
-	rootMfaRes, err := i.checkRootAccountMFA()
+// callerAccount returns the account whose credentials clients use
+func callerAccount(ctx context.Context, clients Clients, region string) (awsAccount, error) {
+	identity, err := clients.STS(region).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
-		return nil, err
+		return awsAccount{}, err
 	}
+	account := awsAccount{ID: aws.StringValue(identity.Account)}
+	if callerARN, err := arn.Parse(aws.StringValue(identity.Arn)); err == nil {
+		account.Partition = callerARN.Partition
+	}
+	return account, nil
+}
 
-	rootAccessKeysRes, err := i.checkRootAccountAccessKeys()
+// Check checks that the user's AWS infra is SOC2 compliant using the rules
+// selected by Options.Filter, on the resources selected by Options.Tags. The
+// inventory of every account is collected once, then every rule is evaluated
+// against it. Results are returned in account, service and rule registration
+// order.
+func (a *AWS) Check(ctx context.Context) ([]Result, error) {
+	s, err := a.Collect(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return a.Evaluate(s), nil
+}
+
+// Collect returns a snapshot of the inventory of every account, collecting
+// the services of the rules selected by Options.Filter. Accounts of an
+// organization are collected concurrently.
+func (a *AWS) Collect(ctx context.Context) (*Snapshot, error) {
+	if a.org != nil {
+		inventories, err := a.org.collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newSnapshot(inventories), nil
+	}
 
-	adminPolicyRes, err := i.checkPolicyNoStatementsWithAdminAccess()
+	inv, err := a.collector.collect(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return newSnapshot([]*Inventory{inv}), nil
+}
 
-	userPolicyRes, err := i.checkNoUserPolicies()
+// Evaluate evaluates the rules selected by opts.Filter against the
+// inventories of s, without calling AWS. Only the options selecting rules,
+// accounts and resources, and the waivers, are used. Only the accounts in
+// opts.Accounts are evaluated, if set.
+func Evaluate(s *Snapshot, opts Options) ([]Result, error) {
+	rules, err := opts.rules()
 	if err != nil {
 		return nil, err
 	}
 
-	return concatSlice(
-		mfaRes,
-		staleCredsRes,
-		rootMfaRes,
-		rootAccessKeysRes,
-		adminPolicyRes,
-		userPolicyRes,
-	), nil
+	selected := *s
+	if len(opts.Accounts) > 0 {
+		selected.Accounts = nil
+		for _, inv := range s.Accounts {
+			if contains(opts.Accounts, inv.AccountID) {
+				selected.Accounts = append(selected.Accounts, inv)
+			}
+		}
+	}
+
+	a := &AWS{
+		rules:   rules,
+		params:  opts.Params,
+		tags:    opts.Tags,
+		waivers: opts.Waivers,
+	}
+	return a.Evaluate(&selected), nil
+}
+
+// Evaluate evaluates a's rules against every inventory of s, then scopes the
+// results by a's tags and applies a's waivers
+func (a *AWS) Evaluate(s *Snapshot) []Result {
+	var res []Result
+	for _, inv := range s.Accounts {
+		res = append(res, evaluateRules(inv, a.rules, a.params)...)
+	}
+	return applyWaivers(filterByTags(res, a.tags), a.waivers, time.Now())
+}
+
+func init() {
+	Register(
+		Rule{
+			ID:       "AWS-IAM-001",
+			Title:    "IAM users with console access must have MFA enabled",
+			Service:  ServiceIAM,
+			Severity: SeverityHigh,
+			Criteria: []string{"CC6.1"},
+			Rationale: "Console passwords can be phished, guessed or reused from other " +
+				"breaches. Requiring MFA for every user who can sign in to the AWS " +
+				"console means a stolen password alone does not grant access to the " +
+				"account.",
+			APICalls: []string{
+				"iam:ListUsers",
+				"iam:ListUserTags",
+				"iam:GetLoginProfile",
+				"iam:ListMFADevices",
+			},
+			Remediation: "Assign a virtual or hardware MFA device to the user, or delete the " +
+				"user's login profile if they do not need console access.",
+			References: []string{
+				"https://docs.aws.amazon.com/IAM/latest/UserGuide/id_credentials_mfa_enable.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 1.10",
+			},
+		},
+		checkConsoleMFA,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-IAM-002",
+			Title:    "IAM users must not have unused credentials",
+			Service:  ServiceIAM,
+			Severity: SeverityMedium,
+			Criteria: []string{"CC6.1", "CC6.2"},
+			Rationale: "Access keys that are not used are not needed, yet remain valid until " +
+				"they are deactivated. Leaked or forgotten keys of former employees and " +
+				"retired systems are a common way into AWS accounts.",
+			APICalls: []string{
+				"iam:ListUsers",
+				"iam:ListUserTags",
+				"iam:ListAccessKeys",
+				"iam:GetAccessKeyLastUsed",
+			},
+			Remediation: "Deactivate access keys that have not been used for more than " +
+				"max_unused_days days, then delete them once nothing breaks. Prefer IAM " +
+				"roles and temporary credentials over long-lived access keys.",
+			References: []string{
+				"https://docs.aws.amazon.com/IAM/latest/UserGuide/id_credentials_access-keys.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 1.12",
+			},
+			Remediable: true,
+			Params: []Param{{
+				Name:        "max_unused_days",
+				Description: "number of days after which an unused access key is stale",
+				Default:     90,
+			}},
+		},
+		checkIAMUsersUnusedCreds,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-IAM-003",
+			Title:    "Root account must have MFA enabled",
+			Service:  ServiceIAM,
+			Severity: SeverityCritical,
+			Criteria: []string{"CC6.1"},
+			Rationale: "The root user has unrestricted access to every resource of the " +
+				"account, including billing and account closure, and cannot be " +
+				"restricted by IAM policies. Its password alone must not be enough to " +
+				"sign in.",
+			APICalls: []string{
+				"iam:GetAccountSummary",
+			},
+			Remediation: "Sign in as the root user and assign an MFA device, preferably a " +
+				"hardware device, in the Security credentials page.",
+			References: []string{
+				"https://docs.aws.amazon.com/IAM/latest/UserGuide/enable-mfa-for-root.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 1.5",
+			},
+		},
+		checkRootAccountMFA,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-IAM-004",
+			Title:    "Root account must not have access keys",
+			Service:  ServiceIAM,
+			Severity: SeverityCritical,
+			Criteria: []string{"CC6.1"},
+			Rationale: "Access keys of the root user grant unrestricted programmatic access to " +
+				"the account that cannot be limited by IAM policies. Day-to-day work " +
+				"should use IAM roles or users instead.",
+			APICalls: []string{
+				"iam:GetAccountSummary",
+			},
+			Remediation: "Sign in as the root user and delete its access keys in the Security " +
+				"credentials page, after moving anything using them to an IAM role.",
+			References: []string{
+				"https://docs.aws.amazon.com/IAM/latest/UserGuide/id_root-user_manage_delete-key.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 1.4",
+			},
+		},
+		checkRootAccountAccessKeys,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-IAM-005",
+			Title:    "IAM policies must not have statements with admin access",
+			Service:  ServiceIAM,
+			Severity: SeverityHigh,
+			Criteria: []string{"CC6.1", "CC6.3"},
+			Rationale: "A policy allowing every action on every resource grants full " +
+				"administrator access to whoever it is attached to. Least privilege " +
+				"requires granting only the actions and resources each principal needs.",
+			APICalls: []string{
+				"iam:ListPolicies",
+				"iam:GetPolicyVersion",
+			},
+			Remediation: "Replace statements allowing \"Action\": \"*\" on \"Resource\": \"*\" " +
+				"with the specific actions and resources required, and make the new " +
+				"policy version the default. Keep administrator access to a few, " +
+				"closely monitored roles.",
+			References: []string{
+				"https://docs.aws.amazon.com/IAM/latest/UserGuide/best-practices.html#grant-least-privilege",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 1.16",
+			},
+		},
+		checkPolicyNoStatementsWithAdminAccess,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-IAM-006",
+			Title:    "IAM users must not have policies attached",
+			Service:  ServiceIAM,
+			Severity: SeverityLow,
+			Criteria: []string{"CC6.3"},
+			Rationale: "Permissions attached to individual users are hard to review and tend " +
+				"to accumulate. Granting permissions through groups and roles keeps " +
+				"access consistent for everyone with the same job function.",
+			APICalls: []string{
+				"iam:ListUsers",
+				"iam:ListUserTags",
+				"iam:ListUserPolicies",
+				"iam:ListAttachedUserPolicies",
+			},
+			Remediation: "Add the user to a group, or let them assume a role, with the " +
+				"permissions they need, then detach the managed policies and delete the " +
+				"inline policies of the user.",
+			References: []string{
+				"https://docs.aws.amazon.com/IAM/latest/UserGuide/id_groups_manage_attach-policy.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 1.15",
+			},
+		},
+		checkNoUserPolicies,
+	)
 }
 
 // checkConsoleMFA checks that IAM users with console access have MFA enabled
-func (i *IAM) checkConsoleMFA() ([]Result, error) {
+func checkConsoleMFA(inv *Inventory, _ Params) ([]Result, error) {
 	var mfaRes []Result
-	rule := "IAM users with console access must have MFA enabled"
 
-	users, err := i.iamAPI.ListUsers(&iam.ListUsersInput{})
-	if err != nil {
+	if err := collectErr(inv.IAM.UsersError); err != nil {
 		return nil, err
 	}
 
-	for _, user := range users.Users {
-		mfa, err := i.iamAPI.ListMFADevices(&iam.ListMFADevicesInput{UserName: user.UserName})
-		if err != nil {
-			return nil, err
+	for _, user := range inv.IAM.Users {
+		if err := collectErr(user.MFAError); err != nil {
+			mfaRes = append(mfaRes, errorResult(userResource(inv, user), err))
+			continue
 		}
-
-		_, err = i.iamAPI.GetLoginProfile(&iam.GetLoginProfileInput{UserName: user.UserName})
-		if err != nil {
-			mfaRes = append(
-				mfaRes,
-				i.userResult(aws.StringValue(user.Arn), rule, true, "User does not have console access"),
-			)
+		if err := collectErr(user.LoginProfileError); err != nil {
+			mfaRes = append(mfaRes, errorResult(userResource(inv, user), err))
 			continue
 		}
 
-		if mfa.MFADevices == nil {
-			mfaRes = append(
-				mfaRes,
-				i.userResult(aws.StringValue(user.Arn), rule, false, "User does not have MFA enabled"),
-			)
+		if user.LoginProfile == nil {
+			mfaRes = append(mfaRes, userResult(inv, user, true, "User does not have console access"))
+			continue
+		}
+		if len(user.MFADevices) == 0 {
+			mfaRes = append(mfaRes, userResult(inv, user, false, "User does not have MFA enabled").
+				remediate(consoleMFARemediation(inv, user)))
 		} else {
-			mfaRes = append(mfaRes, i.userResult(aws.StringValue(user.Arn), rule, true, ""))
+			mfaRes = append(mfaRes, userResult(inv, user, true, ""))
 		}
 	}
 
@@ -160,38 +499,42 @@ func (i *IAM) checkConsoleMFA() ([]Result, error) {
 }
 
 // checkIAMUsersUnusedCreds checks that IAM users have no unused credentials
-func (i *IAM) checkIAMUsersUnusedCreds() ([]Result, error) {
+func checkIAMUsersUnusedCreds(inv *Inventory, params Params) ([]Result, error) {
 	var staleCredsRes []Result
-	rule := "IAM users must not have credentials unused in the last 90 days"
+	maxUnusedDays := params.Int("max_unused_days")
 
-	users, err := i.iamAPI.ListUsers(&iam.ListUsersInput{})
-	if err != nil {
+	if err := collectErr(inv.IAM.UsersError); err != nil {
 		return nil, err
 	}
-	for _, user := range users.Users {
-		accessKeys, err := i.iamAPI.ListAccessKeys(
-			&iam.ListAccessKeysInput{UserName: user.UserName})
-		if err != nil {
-			return nil, err
+	for _, user := range inv.IAM.Users {
+		if err := collectErr(user.AccessKeysError); err != nil {
+			staleCredsRes = append(staleCredsRes, errorResult(userResource(inv, user), err))
+			continue
 		}
 
-		for _, accessKey := range accessKeys.AccessKeyMetadata {
-			if aws.StringValue(accessKey.Status) != "Active" {
+		for _, accessKey := range user.AccessKeys {
+			if aws.StringValue(accessKey.Key.Status) != iam.StatusTypeActive {
 				continue
 			}
 
-			out, err := i.iamAPI.GetAccessKeyLastUsed(
-				&iam.GetAccessKeyLastUsedInput{AccessKeyId: accessKey.AccessKeyId})
-			if err != nil {
-				return nil, err
+			if err := collectErr(accessKey.LastUsedError); err != nil {
+				staleCredsRes = append(staleCredsRes, errorResult(accessKeyResource(inv, user, accessKey), err))
+				continue
 			}
-			if out.AccessKeyLastUsed.LastUsedDate != nil && out.AccessKeyLastUsed.LastUsedDate.AddDate(0, 0, 90).Before(time.Now()) {
+			lastUsed := accessKey.LastUsed.LastUsedDate
+			if lastUsed != nil && lastUsed.AddDate(0, 0, maxUnusedDays).Before(inv.CollectedAt) {
 				staleCredsRes = append(
 					staleCredsRes,
-					i.userResult(aws.StringValue(user.Arn), rule, false, "User has credentials unused for more than 90 days"),
+					newResult(
+						accessKeyResource(inv, user, accessKey),
+						false,
+						fmt.Sprintf("Access key of user %s has been unused for more than %d days",
+							aws.StringValue(user.User.UserName), maxUnusedDays),
+					).remediate(accessKeyRemediation(user, accessKey)).
+						withFix(accessKeyFix(user, accessKey)),
 				)
 			} else {
-				staleCredsRes = append(staleCredsRes, i.userResult(aws.StringValue(user.Arn), rule, true, ""))
+				staleCredsRes = append(staleCredsRes, newResult(accessKeyResource(inv, user, accessKey), true, ""))
 			}
 		}
 	}
@@ -200,608 +543,739 @@ func (i *IAM) checkIAMUsersUnusedCreds() ([]Result, error) {
 }
 
 // checkRootAccountMFA checks that the root account has MFA enabled
-func (i *IAM) checkRootAccountMFA() ([]Result, error) {
-	rule := "Root account must have MFA enabled"
-
-	root, err := i.iamAPI.GetAccountSummary(&iam.GetAccountSummaryInput{})
-	if err != nil {
+func checkRootAccountMFA(inv *Inventory, _ Params) ([]Result, error) {
+	if err := collectErr(inv.IAM.AccountSummaryError); err != nil {
 		return nil, err
 	}
 
-	if aws.Int64Value(root.SummaryMap["AccountMFAEnabled"]) == 0 {
-		return []Result{i.userResult("root", rule, false, "Root account does not have MFA enabled")}, nil
+	if aws.Int64Value(inv.IAM.AccountSummary["AccountMFAEnabled"]) == 0 {
+		return []Result{rootResult(inv, false, "Root account does not have MFA enabled")}, nil
 	}
 
-	return []Result{i.userResult("root", rule, true, "")}, nil
+	return []Result{rootResult(inv, true, "")}, nil
 }
 
 // checkRootAccountAccessKeys checks that the root account has no access keys
-func (i *IAM) checkRootAccountAccessKeys() ([]Result, error) {
-	rule := "Root account must not have access keys"
-
-	root, err := i.iamAPI.GetAccountSummary(&iam.GetAccountSummaryInput{})
-	if err != nil {
+func checkRootAccountAccessKeys(inv *Inventory, _ Params) ([]Result, error) {
+	if err := collectErr(inv.IAM.AccountSummaryError); err != nil {
 		return nil, err
 	}
 
-	if aws.Int64Value(root.SummaryMap["AccountAccessKeysPresent"]) != 0 {
-		return []Result{i.userResult("root", rule, false, "Root account has access keys")}, nil
+	if aws.Int64Value(inv.IAM.AccountSummary["AccountAccessKeysPresent"]) != 0 {
+		return []Result{rootResult(inv, false, "Root account has access keys")}, nil
 	}
 
-	return []Result{i.userResult("root", rule, true, "")}, nil
+	return []Result{rootResult(inv, true, "")}, nil
 }
 
 // checkPolicyNoStatementsWithAdminAccess checks that there are no policy
 // statements with admin access
-func (i *IAM) checkPolicyNoStatementsWithAdminAccess() ([]Result, error) {
+func checkPolicyNoStatementsWithAdminAccess(inv *Inventory, _ Params) ([]Result, error) {
 	var statementsRes []Result
-	rule := "IAM policies must not have statements with admin access"
 
-	policies, err := i.iamAPI.ListPolicies(
-		&iam.ListPoliciesInput{Scope: aws.String("Local")},
-	)
-	if err != nil {
+	if err := collectErr(inv.IAM.PoliciesError); err != nil {
 		return nil, err
 	}
 
 NEXTPOLICY:
-	for _, policy := range policies.Policies {
-		defaultVer, err := i.iamAPI.GetPolicyVersion(
-			&iam.GetPolicyVersionInput{
-				PolicyArn: policy.Arn,
-				VersionId: policy.DefaultVersionId,
-			})
-		if err != nil {
-			return nil, err
+	for _, policy := range inv.IAM.Policies {
+		if err := collectErr(policy.DefaultVersionError); err != nil {
+			statementsRes = append(statementsRes, errorResult(policyResource(inv, policy), err))
+			continue
 		}
 
-		defaultVerJSON, err := url.QueryUnescape(aws.StringValue(defaultVer.PolicyVersion.Document))
+		defaultVerJSON, err := url.QueryUnescape(aws.StringValue(policy.DefaultVersion.Document))
 		if err != nil {
-			return nil, err
+			statementsRes = append(statementsRes, errorResult(policyResource(inv, policy), err))
+			continue
 		}
 
 		var policyDoc map[string]interface{}
 		err = json.NewDecoder(strings.NewReader(defaultVerJSON)).Decode(&policyDoc)
 		if err != nil {
-			return nil, err
+			statementsRes = append(statementsRes, errorResult(policyResource(inv, policy), err))
+			continue
 		}
 
-		statements := policyDoc["Statement"].([]interface{})
+		statements, err := policyStatements(policyDoc)
+		if err != nil {
+			statementsRes = append(statementsRes, errorResult(policyResource(inv, policy), err))
+			continue
+		}
 		for _, statement := range statements {
-			statementMap := statement.(map[string]interface{})
-			isEffectAllow := statementMap["Effect"].(string) == "Allow"
-			isActionAdmin := statementMap["Action"] == "*"
-			isResourceAdmin := statementMap["Resource"] == "*"
-			if isEffectAllow && isActionAdmin && isResourceAdmin {
+			isAdmin, err := isAdminStatement(statement)
+			if err != nil {
+				statementsRes = append(statementsRes, errorResult(policyResource(inv, policy), err))
+				continue NEXTPOLICY
+			}
+			if isAdmin {
 				statementsRes = append(
 					statementsRes,
-					i.policyResult(aws.StringValue(policy.Arn), rule, false, "Policy has statement with admin access"),
+					policyResult(inv, policy, false, "Policy has statement with admin access").
+						remediate(adminPolicyRemediation(policy)),
 				)
 				continue NEXTPOLICY
 			}
 		}
 
-		statementsRes = append(statementsRes, i.policyResult(aws.StringValue(policy.Arn), rule, true, ""))
+		statementsRes = append(statementsRes, policyResult(inv, policy, true, ""))
 	}
 
 	return statementsRes, nil
 }
 
+// policyStatements returns the statements of a policy document, whose
+// Statement element is either a single statement or a list of them
+func policyStatements(doc map[string]interface{}) ([]map[string]interface{}, error) {
+	switch statement := doc["Statement"].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{statement}, nil
+	case []interface{}:
+		var statements []map[string]interface{}
+		for _, s := range statement {
+			m, ok := s.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("policy statement is a %T, not an object", s)
+			}
+			statements = append(statements, m)
+		}
+		return statements, nil
+	default:
+		return nil, fmt.Errorf("policy Statement is a %T, not an object or a list", statement)
+	}
+}
+
+// isAdminStatement reports whether statement allows every action on every
+// resource
+func isAdminStatement(statement map[string]interface{}) (bool, error) {
+	effect, ok := statement["Effect"].(string)
+	if !ok {
+		return false, fmt.Errorf("policy statement Effect is a %T, not a string", statement["Effect"])
+	}
+	actions, err := policyValues(statement, "Action")
+	if err != nil {
+		return false, err
+	}
+	resources, err := policyValues(statement, "Resource")
+	if err != nil {
+		return false, err
+	}
+	return effect == "Allow" && contains(actions, "*") && contains(resources, "*"), nil
+}
+
+// policyValues returns the values of the element of statement with the given
+// name, which is either a string or a list of strings. It returns nil if the
+// element is missing, e.g. for a statement with NotAction.
+func policyValues(statement map[string]interface{}, name string) ([]string, error) {
+	switch v := statement[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("policy statement %s contains a %T, not a string", name, e)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("policy statement %s is a %T, not a string or a list", name, v)
+	}
+}
+
 // checkNoUserPolicies checks that no users have policies attached
-func (i *IAM) checkNoUserPolicies() ([]Result, error) {
+func checkNoUserPolicies(inv *Inventory, _ Params) ([]Result, error) {
 	var userPoliciesRes []Result
-	rule := "IAM users must not have policies attached"
 
-	users, err := i.iamAPI.ListUsers(&iam.ListUsersInput{})
-	if err != nil {
+	if err := collectErr(inv.IAM.UsersError); err != nil {
 		return nil, err
 	}
 
-	for _, user := range users.Users {
-		userPolicies, err := i.iamAPI.ListUserPolicies(
-			&iam.ListUserPoliciesInput{UserName: user.UserName})
-		if err != nil {
-			return nil, err
+	for _, user := range inv.IAM.Users {
+		if err := collectErr(user.InlinePoliciesError); err != nil {
+			userPoliciesRes = append(userPoliciesRes, errorResult(userResource(inv, user), err))
+			continue
 		}
-		if len(userPolicies.PolicyNames) > 0 {
-			userPoliciesRes = append(userPoliciesRes, i.userResult(aws.StringValue(user.UserName), rule, false, "User has inline policies attached"))
+		if len(user.InlinePolicyNames) > 0 {
+			userPoliciesRes = append(userPoliciesRes, userResult(inv, user, false, "User has inline policies attached").
+				remediate(userPoliciesRemediation(user)))
 			continue
 		}
 
-		attachedPolicies, err := i.iamAPI.ListAttachedUserPolicies(
-			&iam.ListAttachedUserPoliciesInput{UserName: user.UserName})
-		if err != nil {
-			return nil, err
+		if err := collectErr(user.AttachedPoliciesError); err != nil {
+			userPoliciesRes = append(userPoliciesRes, errorResult(userResource(inv, user), err))
+			continue
 		}
-		if len(attachedPolicies.AttachedPolicies) > 0 {
-			userPoliciesRes = append(userPoliciesRes, i.userResult(aws.StringValue(user.UserName), rule, false, "User has managed policies attached"))
+		if len(user.AttachedPolicies) > 0 {
+			userPoliciesRes = append(userPoliciesRes, userResult(inv, user, false, "User has managed policies attached").
+				remediate(userPoliciesRemediation(user)))
 			continue
 		}
 
-		userPoliciesRes = append(userPoliciesRes, i.userResult(aws.StringValue(user.UserName), rule, true, ""))
+		userPoliciesRes = append(userPoliciesRes, userResult(inv, user, true, ""))
 	}
 
 	return userPoliciesRes, nil
 }
 
-func (i *IAM) userResult(name, rule string, compliant bool, reason string) Result {
-	return Result{
-		Resource: Resource{
-			Type: "aws/iam-user",
-			Name: name,
-		},
-		Rule:      rule,
-		Compliant: compliant,
-		Reason:    reason,
+func userResult(inv *Inventory, user IAMUser, compliant bool, reason string) Result {
+	return newResult(userResource(inv, user), compliant, reason)
+}
+
+func userResource(inv *Inventory, user IAMUser) Resource {
+	r := Resource{
+		Type:      "aws/iam-user",
+		Name:      aws.StringValue(user.User.UserName),
+		ARN:       aws.StringValue(user.User.Arn),
+		AccountID: inv.AccountID,
+	}
+	// Users whose tags could not be listed are not scoped by tags.
+	if user.TagsError == "" {
+		r.Tags = iamTags(user.User.Tags)
 	}
+	return r
 }
 
-func (i *IAM) policyResult(name, rule string, compliant bool, reason string) Result {
-	return Result{
-		Resource: Resource{
-			Type: "aws/iam-policy",
-			Name: name,
-		},
-		Rule:      rule,
-		Compliant: compliant,
-		Reason:    reason,
+// accessKeyResource returns the resource of an access key of user. Access
+// keys cannot be tagged, so they have the tags of their user.
+func accessKeyResource(inv *Inventory, user IAMUser, key IAMAccessKey) Resource {
+	r := userResource(inv, user)
+	r.Type = "aws/iam-access-key"
+	r.Name = aws.StringValue(key.Key.AccessKeyId)
+	// Access keys have no ARN, and their IDs are unique.
+	r.ARN = ""
+	return r
+}
+
+func rootResult(inv *Inventory, compliant bool, reason string) Result {
+	return newResult(rootResource(inv), compliant, reason)
+}
+
+// rootResource returns the resource of the root user, which cannot be tagged
+func rootResource(inv *Inventory) Resource {
+	return Resource{
+		Type:      "aws/iam-user",
+		Name:      "root",
+		ARN:       inv.account().arn("iam", "", "root"),
+		AccountID: inv.AccountID,
 	}
 }
 
-// S3 checks that the user's IAM infra is SOC2 compliant
-type S3 struct {
-	s3API *s3.S3
+func policyResult(inv *Inventory, policy IAMPolicy, compliant bool, reason string) Result {
+	return newResult(policyResource(inv, policy), compliant, reason)
 }
 
-// NewS3 returns a new S3 integration
-func NewS3(s *session.Session) *S3 {
-	return &S3{s3API: s3.New(s)}
+func policyResource(inv *Inventory, policy IAMPolicy) Resource {
+	return Resource{
+		Type:      "aws/iam-policy",
+		Name:      aws.StringValue(policy.Policy.PolicyName),
+		ARN:       aws.StringValue(policy.Policy.Arn),
+		AccountID: inv.AccountID,
+	}
 }
 
-// Check checks that the user's S3 infra is SOC2 compliant
-func (s *S3) Check() ([]Result, error) {
-	return s.checkS3BucketEncryption()
+func init() {
+	Register(
+		Rule{
+			ID:       "AWS-S3-001",
+			Title:    "S3 buckets must be encrypted",
+			Service:  ServiceS3,
+			Severity: SeverityHigh,
+			Criteria: []string{"CC6.1", "CC6.7"},
+			Rationale: "Encrypting data at rest protects it from access to the underlying " +
+				"storage and is expected by most customer contracts. Default encryption " +
+				"ensures every object written to the bucket is encrypted, whatever the " +
+				"client requests.",
+			APICalls: []string{
+				"s3:ListBuckets",
+				"s3:GetBucketLocation",
+				"s3:GetBucketTagging",
+				"s3:GetBucketEncryption",
+			},
+			Remediation: "Configure default encryption on the bucket, with SSE-S3, or SSE-KMS if " +
+				"access to the data must also be controlled by a KMS key policy.",
+			References: []string{
+				"https://docs.aws.amazon.com/AmazonS3/latest/userguide/default-bucket-encryption.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 2.1.1",
+			},
+			Remediable: true,
+		},
+		checkS3BucketEncryption,
+	)
 }
 
 // checkS3BucketEncryption checks that S3 buckets are encrypted
-func (s *S3) checkS3BucketEncryption() ([]Result, error) {
-	var s3Res []Result
-	rule := "S3 buckets must be encrypted"
+func checkS3BucketEncryption(inv *Inventory, _ Params) ([]Result, error) {
+	var bucketRes []Result
 
-	buckets, err := s.s3API.ListBuckets(nil)
-	if err != nil {
+	if err := collectErr(inv.S3.BucketsError); err != nil {
 		return nil, err
 	}
 
-	for _, bucket := range buckets.Buckets {
-		bucketLoc, err := s.s3API.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: bucket.Name})
-		if err != nil {
-			return nil, err
-		}
-
-		region := aws.StringValue(bucketLoc.LocationConstraint)
-		if len(region) == 0 {
-			// Buckets in Region us-east-1 have a LocationConstraint of null.
-			region = "us-east-1"
+	for _, bucket := range inv.S3.Buckets {
+		if err := collectErr(bucket.LocationError); err != nil {
+			bucketRes = append(bucketRes, errorResult(bucketResource(inv, bucket), err))
+			continue
 		}
-
-		regionSession := session.Must(
-			session.NewSession(
-				aws.NewConfig().WithRegion(region)))
-		regionS3API := s3.New(regionSession)
-
-		encryption, err := regionS3API.GetBucketEncryption(
-			&s3.GetBucketEncryptionInput{Bucket: bucket.Name})
-		if err != nil {
-			return nil, err
+		if err := collectErr(bucket.EncryptionError); err != nil {
+			bucketRes = append(bucketRes, errorResult(bucketResource(inv, bucket), err))
+			continue
 		}
 
-		if encryption.ServerSideEncryptionConfiguration == nil {
-			s3Res = append(
-				s3Res,
-				s.bucketResult(bucket, rule, false, "Bucket is not encrypted"),
-			)
-		} else {
-			s3Res = append(s3Res, s.bucketResult(bucket, rule, true, ""))
+		if bucket.Encryption == nil {
+			bucketRes = append(bucketRes, bucketResult(inv, bucket, false, "Bucket is not encrypted").
+				remediate(bucketEncryptionRemediation(bucket)).
+				withFix(bucketEncryptionFix(bucket)))
+			continue
 		}
+		bucketRes = append(bucketRes, bucketResult(inv, bucket, true, ""))
 	}
 
-	return s3Res, nil
+	return bucketRes, nil
 }
 
-func (s *S3) bucketResult(bucket *s3.Bucket, rule string, compliant bool, reason string) Result {
-	return Result{
-		Resource: Resource{
-			Type: "aws/s3-bucket",
-			Name: aws.StringValue(bucket.Name),
-		},
-		Rule:      rule,
-		Compliant: compliant,
-		Reason:    reason,
-	}
+func bucketResult(inv *Inventory, bucket S3Bucket, compliant bool, reason string) Result {
+	return newResult(bucketResource(inv, bucket), compliant, reason)
 }
 
-// VPC checks that the user's VPCs are SOC2 compliant
-type VPC struct {
-	ec2API  *ec2.EC2
-	regions []string
-}
-
-// NewVPC returns a new VPC integration
-func NewVPC(s *session.Session, regions []string) *VPC {
-	return &VPC{ec2API: ec2.New(s), regions: regions}
-}
-
-// Check checks that the user's VPCs are SOC2 compliant
-func (v *VPC) Check() ([]Result, error) {
-	flowLogsRes, err := v.checkVPCFlowLogs()
-	if err != nil {
-		return nil, err
-	}
-
-	vpcDefaultSGRes, err := v.checkVPCDefaultSecurityGroup()
-	if err != nil {
-		return nil, err
-	}
-
-	restrictedSSH, err := v.checkRestrictedSSH()
-	if err != nil {
-		return nil, err
+// bucketResource returns the resource of bucket. Its region is empty if the
+// bucket's location could not be fetched, and its tags are nil if the
+// bucket's tags could not be fetched.
+func bucketResource(inv *Inventory, bucket S3Bucket) Resource {
+	name := aws.StringValue(bucket.Bucket.Name)
+	return Resource{
+		Type: "aws/s3-bucket",
+		Name: name,
+		// Bucket names are global, so bucket ARNs have no region or account.
+		ARN:       awsAccount{Partition: inv.Partition}.arn("s3", "", name),
+		AccountID: inv.AccountID,
+		Region:    bucket.Region,
+		Tags:      bucket.Tags,
 	}
+}
 
-	return concatSlice(flowLogsRes, vpcDefaultSGRes, restrictedSSH), nil
+func init() {
+	Register(
+		Rule{
+			ID:       "AWS-VPC-001",
+			Title:    "VPC flow logs must be enabled",
+			Service:  ServiceVPC,
+			Severity: SeverityMedium,
+			Criteria: []string{"CC7.2"},
+			Rationale: "Flow logs record the network traffic of a VPC. They are needed to " +
+				"detect anomalous traffic and to investigate security incidents after " +
+				"the fact.",
+			APICalls: []string{
+				"ec2:DescribeVpcs",
+				"ec2:DescribeFlowLogs",
+			},
+			Remediation: "Create a flow log for the VPC delivering at least rejected traffic to " +
+				"CloudWatch Logs or S3.",
+			References: []string{
+				"https://docs.aws.amazon.com/vpc/latest/userguide/flow-logs.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 3.9",
+			},
+			Remediable: true,
+		},
+		checkVPCFlowLogs,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-VPC-002",
+			Title:    "VPC default security group must have no inbound or outbound rules",
+			Service:  ServiceVPC,
+			Severity: SeverityMedium,
+			Criteria: []string{"CC6.6"},
+			Rationale: "Resources launched without a security group get the default security " +
+				"group. If it has rules, they may be exposed unintentionally, so all " +
+				"traffic should be explicitly allowed by purpose-built security groups.",
+			APICalls: []string{
+				"ec2:DescribeVpcs",
+				"ec2:DescribeSecurityGroups",
+			},
+			Remediation: "Move any resources using the default security group to purpose-built " +
+				"security groups, then remove every inbound and outbound rule of the " +
+				"default security group.",
+			References: []string{
+				"https://docs.aws.amazon.com/vpc/latest/userguide/default-security-group.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 5.4",
+			},
+		},
+		checkVPCDefaultSecurityGroup,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-VPC-003",
+			Title:    "SSH must not be accessible from 0.0.0.0/0 or ::/0",
+			Service:  ServiceVPC,
+			Severity: SeverityHigh,
+			Criteria: []string{"CC6.6"},
+			Rationale: "SSH open to the whole internet is constantly scanned and brute-forced. " +
+				"Remote administration must only be reachable from trusted networks.",
+			APICalls: []string{
+				"ec2:DescribeVpcs",
+				"ec2:DescribeSecurityGroups",
+			},
+			Remediation: "Remove the inbound rules allowing port 22 from 0.0.0.0/0 or ::/0 and " +
+				"allow SSH only from known address ranges, or use AWS Systems Manager " +
+				"Session Manager instead of SSH.",
+			References: []string{
+				"https://docs.aws.amazon.com/vpc/latest/userguide/security-group-rules.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 5.2",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 5.3",
+			},
+			Remediable: true,
+		},
+		checkRestrictedSSH,
+	)
 }
 
-// checkVPCFlowLogs checks that VPC flow logs are enabled
-func (v *VPC) checkVPCFlowLogs() ([]Result, error) {
+// forEachVPC calls fn with every VPC of every region in inv, in region order.
+// A region whose VPCs could not be listed yields a StatusError result; err,
+// if set, is reported for every VPC instead of calling fn.
+func forEachVPC(inv *Inventory, err func(RegionInventory) error, fn func(RegionInventory, *ec2.Vpc) []Result) []Result {
 	var vpcRes []Result
-	rule := "VPC flow logs must be enabled"
-
-	for _, region := range v.regions {
-		regionSession := session.Must(
-			session.NewSession(
-				aws.NewConfig().WithRegion(region)))
-		regionEC2API := ec2.New(regionSession)
-
-		vpcs, err := regionEC2API.DescribeVpcs(nil)
-		if err != nil {
-			return nil, err
+	for _, region := range inv.Regions {
+		if vpcsErr := collectErr(region.VPCsError); vpcsErr != nil {
+			vpcRes = append(vpcRes, errorResult(regionResource(inv.AccountID, region.Region), vpcsErr))
+			continue
 		}
 
-		for _, vpc := range vpcs.Vpcs {
-			flowLogs, err := regionEC2API.DescribeFlowLogs(
-				&ec2.DescribeFlowLogsInput{Filter: []*ec2.Filter{
-					{
-						Name:   aws.String("resource-id"),
-						Values: []*string{vpc.VpcId},
-					},
-				}})
-			if err != nil {
-				return nil, err
-			}
-
-			if len(flowLogs.FlowLogs) == 0 {
-				vpcRes = append(
-					vpcRes,
-					v.vpcResult(vpc, rule, false, "VPC flow logs are not enabled"),
-				)
-			} else {
-				vpcRes = append(vpcRes, v.vpcResult(vpc, rule, true, ""))
+		for _, vpc := range region.VPCs {
+			if regionErr := err(region); regionErr != nil {
+				vpcRes = append(vpcRes, errorResult(vpcResource(inv, region, vpc), regionErr))
+				continue
 			}
+			vpcRes = append(vpcRes, fn(region, vpc)...)
 		}
 	}
+	return vpcRes
+}
 
-	return vpcRes, nil
+// checkVPCFlowLogs checks that VPC flow logs are enabled
+func checkVPCFlowLogs(inv *Inventory, _ Params) ([]Result, error) {
+	flowLogsErr := func(region RegionInventory) error { return collectErr(region.FlowLogsError) }
+	return forEachVPC(inv, flowLogsErr, func(region RegionInventory, vpc *ec2.Vpc) []Result {
+		for _, flowLog := range region.FlowLogs {
+			if aws.StringValue(flowLog.ResourceId) == aws.StringValue(vpc.VpcId) {
+				return []Result{vpcResult(inv, region, vpc, true, "")}
+			}
+		}
+		return []Result{vpcResult(inv, region, vpc, false, "VPC flow logs are not enabled").
+			remediate(flowLogsRemediation(region, vpc)).
+			withFix(flowLogsFix(region, vpc))}
+	}), nil
 }
 
 // checkVPCDefaultSecurityGroup checks that the default security group has no
 // inbound or outbound rules
-func (v *VPC) checkVPCDefaultSecurityGroup() ([]Result, error) {
-	var vpcRes []Result
-	rule := "VPC default security group must have no inbound or outbound rules"
-
-	for _, region := range v.regions {
-		regionSession := session.Must(
-			session.NewSession(
-				aws.NewConfig().WithRegion(region)))
-		regionEC2API := ec2.New(regionSession)
-
-		vpcs, err := regionEC2API.DescribeVpcs(nil)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, vpc := range vpcs.Vpcs {
-			sgs, err := regionEC2API.DescribeSecurityGroups(
-				&ec2.DescribeSecurityGroupsInput{Filters: []*ec2.Filter{
-					{
-						Name:   aws.String("group-name"),
-						Values: []*string{aws.String("default")},
-					},
-					{
-						Name:   aws.String("vpc-id"),
-						Values: []*string{vpc.VpcId},
-					},
-				}})
-			if err != nil {
-				return nil, err
+func checkVPCDefaultSecurityGroup(inv *Inventory, _ Params) ([]Result, error) {
+	sgsErr := func(region RegionInventory) error { return collectErr(region.SecurityGroupsError) }
+	return forEachVPC(inv, sgsErr, func(region RegionInventory, vpc *ec2.Vpc) []Result {
+		var sgRes []Result
+		for _, sg := range vpcSecurityGroups(region, vpc) {
+			if aws.StringValue(sg.GroupName) != "default" {
+				continue
 			}
 
-			for _, sg := range sgs.SecurityGroups {
-				if len(sg.IpPermissions) == 0 && len(sg.IpPermissionsEgress) == 0 {
-					vpcRes = append(
-						vpcRes,
-						v.sgResult(sg, rule, true, ""),
-					)
-				} else {
-					vpcRes = append(
-						vpcRes,
-						v.sgResult(sg, rule, false, "Default security group has inbound or outbound rules"),
-					)
-				}
+			if len(sg.IpPermissions) == 0 && len(sg.IpPermissionsEgress) == 0 {
+				sgRes = append(sgRes, sgResult(inv, region, sg, true, ""))
+			} else {
+				sgRes = append(
+					sgRes,
+					sgResult(inv, region, sg, false, "Default security group has inbound or outbound rules").
+						remediate(defaultSecurityGroupRemediation(region, sg)),
+				)
 			}
 		}
-	}
-	return vpcRes, nil
+		return sgRes
+	}), nil
 }
 
 // checkRestrictedSSH checks that SSH is restricted, i.e. not accessible from
 // 0.0.0.0/0 or ::/0
-func (v *VPC) checkRestrictedSSH() ([]Result, error) {
-	var vpcRes []Result
-	rule := "SSH must not be accessible from 0.0.0.0/0 or ::/0"
-
-	for _, region := range v.regions {
-		regionSession := session.Must(
-			session.NewSession(
-				aws.NewConfig().WithRegion(region)))
-		regionEC2API := ec2.New(regionSession)
-
-		vpcs, err := regionEC2API.DescribeVpcs(nil)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, vpc := range vpcs.Vpcs {
-			sgs, err := regionEC2API.DescribeSecurityGroups(
-				&ec2.DescribeSecurityGroupsInput{Filters: []*ec2.Filter{
-					{
-						Name:   aws.String("vpc-id"),
-						Values: []*string{vpc.VpcId},
-					},
-				}})
-			if err != nil {
-				return nil, err
-			}
-
-		NEXTSG:
-			for _, sg := range sgs.SecurityGroups {
-				for _, ipPermission := range sg.IpPermissions {
-					for _, ipRange := range ipPermission.IpRanges {
-						if aws.StringValue(ipRange.CidrIp) == "0.0.0.0/0" &&
-							aws.Int64Value(ipPermission.FromPort) <= 22 &&
-							aws.Int64Value(ipPermission.ToPort) >= 22 &&
-							aws.StringValue(ipPermission.IpProtocol) == "tcp" {
-							vpcRes = append(
-								vpcRes,
-								v.sgResult(sg, rule, false, "SSH is accessible from all IPv4 Addresses"),
-							)
-							continue NEXTSG
-						}
+func checkRestrictedSSH(inv *Inventory, _ Params) ([]Result, error) {
+	sgsErr := func(region RegionInventory) error { return collectErr(region.SecurityGroupsError) }
+	return forEachVPC(inv, sgsErr, func(region RegionInventory, vpc *ec2.Vpc) []Result {
+		var sgRes []Result
+
+	NEXTSG:
+		for _, sg := range vpcSecurityGroups(region, vpc) {
+			for _, ipPermission := range sg.IpPermissions {
+				for _, ipRange := range ipPermission.IpRanges {
+					if aws.StringValue(ipRange.CidrIp) == "0.0.0.0/0" &&
+						aws.Int64Value(ipPermission.FromPort) <= 22 &&
+						aws.Int64Value(ipPermission.ToPort) >= 22 &&
+						aws.StringValue(ipPermission.IpProtocol) == "tcp" {
+						sgRes = append(
+							sgRes,
+							sgResult(inv, region, sg, false, "SSH is accessible from all IPv4 Addresses").
+								remediate(sshRemediation(region, sg)).
+								withFix(sshFix(region, sg)),
+						)
+						continue NEXTSG
 					}
+				}
 
-					for _, ipRange := range ipPermission.Ipv6Ranges {
-						if aws.StringValue(ipRange.CidrIpv6) == "::/0" &&
-							aws.Int64Value(ipPermission.FromPort) <= 22 &&
-							aws.Int64Value(ipPermission.ToPort) >= 22 &&
-							aws.StringValue(ipPermission.IpProtocol) == "tcp" {
-							vpcRes = append(
-								vpcRes,
-								v.sgResult(sg, rule, false, "SSH is accessible from all IPv6 Addresses"),
-							)
-							continue NEXTSG
-						}
+				for _, ipRange := range ipPermission.Ipv6Ranges {
+					if aws.StringValue(ipRange.CidrIpv6) == "::/0" &&
+						aws.Int64Value(ipPermission.FromPort) <= 22 &&
+						aws.Int64Value(ipPermission.ToPort) >= 22 &&
+						aws.StringValue(ipPermission.IpProtocol) == "tcp" {
+						sgRes = append(
+							sgRes,
+							sgResult(inv, region, sg, false, "SSH is accessible from all IPv6 Addresses").
+								remediate(sshRemediation(region, sg)).
+								withFix(sshFix(region, sg)),
+						)
+						continue NEXTSG
 					}
 				}
-
-				vpcRes = append(
-					vpcRes,
-					v.sgResult(sg, rule, true, ""),
-				)
 			}
+
+			sgRes = append(sgRes, sgResult(inv, region, sg, true, ""))
 		}
-	}
-	return vpcRes, nil
-}
 
-func (v *VPC) vpcResult(vpc *ec2.Vpc, rule string, compliant bool, reason string) Result {
-	return Result{
-		Resource: Resource{
-			Type: "aws/vpc",
-			Name: aws.StringValue(vpc.VpcId),
-		},
-		Rule:      rule,
-		Compliant: compliant,
-		Reason:    reason,
-	}
+		return sgRes
+	}), nil
 }
 
-func (v *VPC) sgResult(sg *ec2.SecurityGroup, rule string, compliant bool, reason string) Result {
-	return Result{
-		Resource: Resource{
-			Type: "aws/security-group",
-			Name: aws.StringValue(sg.GroupId),
-		},
-		Rule:      rule,
-		Compliant: compliant,
-		Reason:    reason,
+// vpcSecurityGroups returns the security groups of vpc in region
+func vpcSecurityGroups(region RegionInventory, vpc *ec2.Vpc) []*ec2.SecurityGroup {
+	var sgs []*ec2.SecurityGroup
+	for _, sg := range region.SecurityGroups {
+		if aws.StringValue(sg.VpcId) == aws.StringValue(vpc.VpcId) {
+			sgs = append(sgs, sg)
+		}
 	}
+	return sgs
 }
 
-// CloudTrail checks that the user's CloudTrail is SOC2 compliant
-type CloudTrail struct {
-	cloudTrailAPI *cloudtrail.CloudTrail
-	regions       []string
-}
-
-// NewCloudTrail returns a new CloudTrail integration
-func NewCloudTrail(s *session.Session, regions []string) *CloudTrail {
-	return &CloudTrail{cloudTrailAPI: cloudtrail.New(s), regions: regions}
+func vpcResult(inv *Inventory, region RegionInventory, vpc *ec2.Vpc, compliant bool, reason string) Result {
+	return newResult(vpcResource(inv, region, vpc), compliant, reason)
 }
 
-// Check checks that the user's CloudTrail is SOC2 compliant
-func (c *CloudTrail) Check() ([]Result, error) {
-	cloudTrailEncryptionRes, err := c.checkCloudTrailEncryption()
-	if err != nil {
-		return nil, err
+func vpcResource(inv *Inventory, region RegionInventory, vpc *ec2.Vpc) Resource {
+	// Shared VPCs are owned by another account.
+	account := inv.account().withID(aws.StringValue(vpc.OwnerId))
+	return Resource{
+		Type:      "aws/vpc",
+		Name:      aws.StringValue(vpc.VpcId),
+		ARN:       account.arn("ec2", region.Region, "vpc/"+aws.StringValue(vpc.VpcId)),
+		AccountID: account.ID,
+		Region:    region.Region,
+		Tags:      ec2Tags(vpc.Tags),
 	}
+}
 
-	multiRegionRes, err := c.checkMultiRegionTrail()
-	if err != nil {
-		return nil, err
-	}
+func sgResult(inv *Inventory, region RegionInventory, sg *ec2.SecurityGroup, compliant bool, reason string) Result {
+	return newResult(sgResource(inv, region, sg), compliant, reason)
+}
 
-	logValidationRes, err := c.checkLogValidation()
-	if err != nil {
-		return nil, err
+func sgResource(inv *Inventory, region RegionInventory, sg *ec2.SecurityGroup) Resource {
+	account := inv.account().withID(aws.StringValue(sg.OwnerId))
+	return Resource{
+		Type:      "aws/security-group",
+		Name:      aws.StringValue(sg.GroupId),
+		ARN:       account.arn("ec2", region.Region, "security-group/"+aws.StringValue(sg.GroupId)),
+		AccountID: account.ID,
+		Region:    region.Region,
+		Tags:      ec2Tags(sg.Tags),
 	}
+}
 
-	return concatSlice(cloudTrailEncryptionRes, multiRegionRes, logValidationRes), nil
+func init() {
+	Register(
+		Rule{
+			ID:       "AWS-CT-001",
+			Title:    "CloudTrail must be encrypted",
+			Service:  ServiceCloudTrail,
+			Severity: SeverityMedium,
+			Criteria: []string{"CC6.1", "CC7.2"},
+			Rationale: "CloudTrail logs contain sensitive information about the account. " +
+				"Encrypting them with a KMS key means reading them also requires " +
+				"permission to decrypt with the key.",
+			APICalls: []string{
+				"cloudtrail:DescribeTrails",
+				"cloudtrail:ListTags",
+			},
+			Remediation: "Configure the trail to encrypt its log files with a KMS key (SSE-KMS) " +
+				"whose key policy lets CloudTrail encrypt and only log readers decrypt.",
+			References: []string{
+				"https://docs.aws.amazon.com/awscloudtrail/latest/userguide/encrypting-cloudtrail-log-files-with-aws-kms.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 3.7",
+			},
+		},
+		checkCloudTrailEncryption,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-CT-002",
+			Title:    "CloudTrail must have multi-region trails enabled",
+			Service:  ServiceCloudTrail,
+			Severity: SeverityHigh,
+			Criteria: []string{"CC7.2", "CC7.3"},
+			Rationale: "An audit trail of every management event in every region is needed to " +
+				"detect and investigate changes to the account, including activity in " +
+				"regions that are not normally used.",
+			APICalls: []string{
+				"cloudtrail:DescribeTrails",
+				"cloudtrail:ListTags",
+				"cloudtrail:GetEventSelectors",
+			},
+			Remediation: "Create a multi-region trail, or turn an existing trail into one, " +
+				"logging all read and write management events.",
+			References: []string{
+				"https://docs.aws.amazon.com/awscloudtrail/latest/userguide/receive-cloudtrail-log-files-from-multiple-regions.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 3.1",
+			},
+		},
+		checkMultiRegionTrail,
+	)
+	Register(
+		Rule{
+			ID:       "AWS-CT-003",
+			Title:    "CloudTrail must have log file validation enabled",
+			Service:  ServiceCloudTrail,
+			Severity: SeverityMedium,
+			Criteria: []string{"CC7.2"},
+			Rationale: "Log file validation lets auditors prove that CloudTrail log files were " +
+				"not modified or deleted after CloudTrail delivered them.",
+			APICalls: []string{
+				"cloudtrail:DescribeTrails",
+				"cloudtrail:ListTags",
+			},
+			Remediation: "Enable log file validation on the trail.",
+			References: []string{
+				"https://docs.aws.amazon.com/awscloudtrail/latest/userguide/cloudtrail-log-file-validation-intro.html",
+				"CIS Amazon Web Services Foundations Benchmark v1.5.0, recommendation 3.2",
+			},
+			Remediable: true,
+		},
+		checkLogValidation,
+	)
 }
 
 // checkCloudTrailEncryption checks that CloudTrail is encrypted
-func (c *CloudTrail) checkCloudTrailEncryption() ([]Result, error) {
+func checkCloudTrailEncryption(inv *Inventory, _ Params) ([]Result, error) {
 	var ctRes []Result
-	rule := "CloudTrail must be encrypted"
-
-	trails, err := c.cloudTrailAPI.DescribeTrails(nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// first, check for multi-region trails
-	for _, trail := range trails.TrailList {
-		if !aws.BoolValue(trail.IsMultiRegionTrail) {
-			continue
-		}
 
-		if aws.StringValue(trail.KmsKeyId) == "" {
-			ctRes = append(
-				ctRes,
-				c.trailResult(trail, rule, false, "CloudTrail is not encrypted"),
-			)
+	for _, trail := range inv.CloudTrail.Trails {
+		if aws.StringValue(trail.Trail.KmsKeyId) == "" {
+			ctRes = append(ctRes, trailResult(inv, trail, false, "CloudTrail is not encrypted").
+				remediate(trailEncryptionRemediation(trail)))
 			continue
 		}
-		ctRes = append(ctRes, c.trailResult(trail, rule, true, ""))
-	}
-
-	// next, check for single-region trails
-	for _, region := range c.regions {
-		regionSession := session.Must(
-			session.NewSession(
-				aws.NewConfig().WithRegion(region)))
-		regionCloudTrailAPI := cloudtrail.New(regionSession)
-
-		trails, err := regionCloudTrailAPI.DescribeTrails(nil)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, trail := range trails.TrailList {
-			if aws.BoolValue(trail.IsMultiRegionTrail) {
-				continue
-			}
-
-			if aws.StringValue(trail.KmsKeyId) == "" {
-				ctRes = append(
-					ctRes,
-					c.trailResult(trail, rule, false, "CloudTrail is not encrypted"),
-				)
-				continue
-			}
-			ctRes = append(ctRes, c.trailResult(trail, rule, true, ""))
-		}
+		ctRes = append(ctRes, trailResult(inv, trail, true, ""))
 	}
 
-	return ctRes, nil
+	return append(ctRes, trailRegionErrors(inv)...), nil
 }
 
 // checkMultiRegionTrail checks that CloudTrail has at least one multi-region
 // trail enabled
-func (c *CloudTrail) checkMultiRegionTrail() ([]Result, error) {
-	rule := "CloudTrail must have multi-region trails enabled"
+func checkMultiRegionTrail(inv *Inventory, _ Params) ([]Result, error) {
+	// The rule is about the account rather than any one trail, so its
+	// results are not scoped by tags. Otherwise an account would have no
+	// result if the trail meeting the rule was excluded.
+	return withoutTags(multiRegionTrailResults(inv)), nil
+}
 
-	trails, err := c.cloudTrailAPI.DescribeTrails(nil)
-	if err != nil {
-		return nil, err
-	}
+// multiRegionTrailResults returns the result of the first trail meeting the
+// requirements of checkMultiRegionTrail, or the errors that kept it from
+// being found
+func multiRegionTrailResults(inv *Inventory) []Result {
+	var errRes []Result
 
-	for _, trail := range trails.TrailList {
-		if aws.BoolValue(trail.IsMultiRegionTrail) {
-			eventSelectors, err := c.cloudTrailAPI.GetEventSelectors(
-				&cloudtrail.GetEventSelectorsInput{
-					TrailName: trail.Name,
-				})
-			if err != nil {
-				return nil, err
-			}
-			if len(eventSelectors.EventSelectors) != 0 {
-				for _, selector := range eventSelectors.EventSelectors {
-					// Any event selector matching an event is logged, so this
-					// trail meets the rule requirements.
-					if aws.BoolValue(selector.IncludeManagementEvents) && len(selector.ExcludeManagementEventSources) == 0 {
-						return []Result{c.trailResult(trail, rule, true, "")}, nil
-					}
-				}
+	for _, trail := range inv.CloudTrail.Trails {
+		if !aws.BoolValue(trail.Trail.IsMultiRegionTrail) {
+			continue
+		}
+		if err := collectErr(trail.EventSelectorsError); err != nil {
+			errRes = append(errRes, errorResult(trailResource(inv, trail), err))
+			continue
+		}
+		for _, selector := range trail.EventSelectors {
+			// Any event selector matching an event is logged, so this
+			// trail meets the rule requirements.
+			if aws.BoolValue(selector.IncludeManagementEvents) && len(selector.ExcludeManagementEventSources) == 0 {
+				return []Result{trailResult(inv, trail, true, "")}
 			}
-			// TODO: determine if trails with advanced event selectors can log
-			// all required events
 		}
+		// TODO: determine if trails with advanced event selectors can log
+		// all required events
 	}
 
-	return []Result{{
-		Resource: Resource{
-			Type: "aws/cloudtrail",
-			Name: "N/A",
+	// A trail we failed to inspect, or in a region we failed to list, may
+	// have met the rule requirements.
+	errRes = append(errRes, trailRegionErrors(inv)...)
+	if len(errRes) > 0 {
+		return errRes
+	}
+
+	return []Result{newResult(
+		Resource{
+			Type:      "aws/cloudtrail",
+			Name:      "N/A",
+			AccountID: inv.AccountID,
 		},
-		Rule:      rule,
-		Compliant: false,
-		Reason:    "CloudTrail does not have multi-region trails enabled",
-	}}, nil
+		false,
+		"CloudTrail does not have multi-region trails enabled",
+	).remediate(multiRegionTrailRemediation())}
 }
 
 // checkLogValidation checks that CloudTrail log file validation is enabled
-func (c *CloudTrail) checkLogValidation() ([]Result, error) {
+func checkLogValidation(inv *Inventory, _ Params) ([]Result, error) {
 	var ctRes []Result
-	rule := "CloudTrail must have log file validation enabled"
-
-	trails, err := c.cloudTrailAPI.DescribeTrails(nil)
-	if err != nil {
-		return nil, err
-	}
 
-	for _, trail := range trails.TrailList {
-		if aws.BoolValue(trail.LogFileValidationEnabled) {
-			ctRes = append(ctRes, c.trailResult(trail, rule, true, ""))
+	for _, trail := range inv.CloudTrail.Trails {
+		if aws.BoolValue(trail.Trail.LogFileValidationEnabled) {
+			ctRes = append(ctRes, trailResult(inv, trail, true, ""))
 			continue
 		}
 		ctRes = append(
 			ctRes,
-			c.trailResult(trail, rule, false, "CloudTrail does not have log file validation enabled"),
+			trailResult(inv, trail, false, "CloudTrail does not have log file validation enabled").
+				remediate(logValidationRemediation(trail)).
+				withFix(logValidationFix(trail)),
 		)
 	}
 
-	return ctRes, nil
+	return append(ctRes, trailRegionErrors(inv)...), nil
 }
 
-func (c *CloudTrail) trailResult(trail *cloudtrail.Trail, rule string, compliant bool, reason string) Result {
-	return Result{
-		Resource: Resource{
-			Type: "aws/cloudtrail",
-			Name: aws.StringValue(trail.Name),
-		},
-		Rule:      rule,
-		Compliant: compliant,
-		Reason:    reason,
+// trailRegionErrors returns a StatusError result for every region whose
+// trails could not be listed
+func trailRegionErrors(inv *Inventory) []Result {
+	var errRes []Result
+	for _, region := range inv.Regions {
+		if err := collectErr(region.TrailsError); err != nil {
+			errRes = append(errRes, errorResult(regionResource(inv.AccountID, region.Region), err))
+		}
+	}
+	return errRes
+}
+
+func trailResult(inv *Inventory, trail CloudTrailTrail, compliant bool, reason string) Result {
+	return newResult(trailResource(inv, trail), compliant, reason)
+}
+
+func trailResource(inv *Inventory, trail CloudTrailTrail) Resource {
+	// Organization trails are owned by the management account.
+	accountID := inv.AccountID
+	if trailARN, err := arn.Parse(aws.StringValue(trail.Trail.TrailARN)); err == nil {
+		accountID = trailARN.AccountID
+	}
+	return Resource{
+		Type:      "aws/cloudtrail",
+		Name:      aws.StringValue(trail.Trail.Name),
+		ARN:       aws.StringValue(trail.Trail.TrailARN),
+		AccountID: accountID,
+		Region:    aws.StringValue(trail.Trail.HomeRegion),
+		Tags:      trail.Tags,
 	}
 }
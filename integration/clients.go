@@ -0,0 +1,197 @@
+package integration
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/cloudtrail/cloudtrailiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// Clients creates the AWS service clients used by the checks. Tests can
+// provide their own implementation returning mocked clients.
+type Clients interface {
+	IAM(region string) iamiface.IAMAPI
+	S3(region string) s3iface.S3API
+	EC2(region string) ec2iface.EC2API
+	CloudTrail(region string) cloudtrailiface.CloudTrailAPI
+	STS(region string) stsiface.STSAPI
+	Organizations(region string) organizationsiface.OrganizationsAPI
+	// AssumeRole returns Clients whose clients use the credentials of the
+	// role, assumed with these Clients' credentials. externalID is optional.
+	AssumeRole(roleARN, externalID string) Clients
+}
+
+// sessionClients creates clients from a session. Every client inherits the
+// session's configuration, including its credentials, so all clients of an
+// account share one credential cache and refresh.
+//
+// Clients are cached by service and region, and assumed roles by role, so
+// every check of a scan reuses the same clients. AWS clients are safe for
+// concurrent use.
+type sessionClients struct {
+	s *session.Session
+	// credsSession creates the STS clients that assume roles. It is s
+	// without the transport recording or replaying API calls, so that
+	// assumed role credentials are never written to recordings. It is nil
+	// when replaying, since assumed roles then reuse the credentials of s.
+	credsSession *session.Session
+	// sessionName is the role session name of assumed roles
+	sessionName string
+	endpoints   Endpoints
+	// fixtures, if set, is the directory the calls of s are recorded to or
+	// replayed from. The clients of assumed roles use the subdirectory of
+	// their account.
+	fixtures *fixtureDir
+
+	mu      sync.Mutex
+	clients map[clientKey]interface{}
+	roles   map[roleKey]Clients
+}
+
+type clientKey struct {
+	service string
+	region  string
+}
+
+type roleKey struct {
+	roleARN    string
+	externalID string
+}
+
+// NewSessionClients returns Clients that create clients from s, using the
+// given endpoint overrides
+func NewSessionClients(s *session.Session, endpoints Endpoints) Clients {
+	return newSessionClients(s, s, defaultSessionName, endpoints)
+}
+
+// newSessionClients returns Clients that create clients from s and assume
+// roles with credsSession, if set
+func newSessionClients(s, credsSession *session.Session, sessionName string, endpoints Endpoints) *sessionClients {
+	return &sessionClients{
+		s:            s,
+		credsSession: credsSession,
+		sessionName:  sessionName,
+		endpoints:    endpoints,
+		clients:      map[clientKey]interface{}{},
+		roles:        map[roleKey]Clients{},
+	}
+}
+
+// cachedClient returns the client of service for region, creating it with
+// newClient the first time
+func cachedClient[T any](c *sessionClients, service, region string, newClient func(client.ConfigProvider, ...*aws.Config) T) T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := clientKey{service: service, region: region}
+	if cl, ok := c.clients[key]; ok {
+		return cl.(T)
+	}
+	cl := newClient(c.s, c.config(service, region))
+	c.clients[key] = cl
+	return cl
+}
+
+// config returns the configuration of a client of service for region
+func (c *sessionClients) config(service, region string) *aws.Config {
+	cfg := aws.NewConfig().WithRegion(region)
+	if endpoint := c.endpoints.lookup(service); endpoint != "" {
+		cfg = cfg.WithEndpoint(endpoint)
+		if service == s3.EndpointsID {
+			// Emulators such as LocalStack don't resolve virtual-hosted
+			// bucket names.
+			cfg = cfg.WithS3ForcePathStyle(true)
+		}
+	}
+	return cfg
+}
+
+// IAM returns an IAM client for region
+func (c *sessionClients) IAM(region string) iamiface.IAMAPI {
+	return cachedClient(c, iam.EndpointsID, region, iam.New)
+}
+
+// S3 returns an S3 client for region
+func (c *sessionClients) S3(region string) s3iface.S3API {
+	return cachedClient(c, s3.EndpointsID, region, s3.New)
+}
+
+// EC2 returns an EC2 client for region
+func (c *sessionClients) EC2(region string) ec2iface.EC2API {
+	return cachedClient(c, ec2.EndpointsID, region, ec2.New)
+}
+
+// CloudTrail returns a CloudTrail client for region
+func (c *sessionClients) CloudTrail(region string) cloudtrailiface.CloudTrailAPI {
+	return cachedClient(c, cloudtrail.EndpointsID, region, cloudtrail.New)
+}
+
+// STS returns an STS client for region
+func (c *sessionClients) STS(region string) stsiface.STSAPI {
+	return cachedClient(c, sts.EndpointsID, region, sts.New)
+}
+
+// Organizations returns an Organizations client for region
+func (c *sessionClients) Organizations(region string) organizationsiface.OrganizationsAPI {
+	return cachedClient(c, organizations.EndpointsID, region, organizations.New)
+}
+
+// AssumeRole returns Clients that assume roleARN. Credentials are refreshed
+// before they expire. When replaying, the role's clients reuse the
+// credentials of c, since recorded responses don't depend on them.
+func (c *sessionClients) AssumeRole(roleARN, externalID string) Clients {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := roleKey{roleARN: roleARN, externalID: externalID}
+	if roleClients, ok := c.roles[key]; ok {
+		return roleClients
+	}
+
+	s := c.s
+	if c.fixtures != nil {
+		var account string
+		if parsed, err := arn.Parse(roleARN); err == nil {
+			account = parsed.AccountID
+		}
+		s = s.Copy(&aws.Config{HTTPClient: c.fixtures.client(account)})
+	}
+
+	if c.credsSession == nil {
+		roleClients := newSessionClients(s, nil, c.sessionName, c.endpoints)
+		roleClients.fixtures = c.fixtures
+		c.roles[key] = roleClients
+		return roleClients
+	}
+
+	// Not c.STS, which would deadlock on c.mu, and would record the
+	// credentials.
+	region := aws.StringValue(c.credsSession.Config.Region)
+	stsAPI := sts.New(c.credsSession, c.config(sts.EndpointsID, region))
+	creds := stscreds.NewCredentialsWithClient(stsAPI, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = c.sessionName
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+	withCreds := aws.NewConfig().WithCredentials(creds)
+	roleClients := newSessionClients(s.Copy(withCreds), c.credsSession.Copy(withCreds), c.sessionName, c.endpoints)
+	roleClients.fixtures = c.fixtures
+	c.roles[key] = roleClients
+	return roleClients
+}
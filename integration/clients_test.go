@@ -0,0 +1,227 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// credentialRe extracts the access key ID from a SigV4 Authorization header
+var credentialRe = regexp.MustCompile(`Credential=([^/]+)/`)
+
+// fakeOrganizationServer answers the STS, Organizations and IAM calls of an
+// organization scan. Every role it issues credentials for is in the account
+// named by its ARN. Only the management account has root MFA enabled, and
+// every account has a single user named after it.
+type fakeOrganizationServer struct {
+	mu           sync.Mutex
+	sessionNames []string
+}
+
+// signingAccount returns the account of the credentials r is signed with
+func signingAccount(r *http.Request) string {
+	if m := credentialRe.FindStringSubmatch(r.Header.Get("Authorization")); m != nil && strings.HasPrefix(m[1], "ASIA") {
+		return strings.TrimPrefix(m[1], "ASIA")
+	}
+	return "111122223333"
+}
+
+func (f *fakeOrganizationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		if target != "AWSOrganizationsV20161128.ListAccounts" {
+			http.Error(w, "unexpected target "+target, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprint(w, `{"Accounts":[`+
+			`{"Id":"111122223333","Name":"management","Status":"ACTIVE"},`+
+			`{"Id":"222233334444","Name":"production","Status":"ACTIVE"}]}`)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	switch action := r.PostForm.Get("Action"); action {
+	case "AssumeRole":
+		f.mu.Lock()
+		f.sessionNames = append(f.sessionNames, r.PostForm.Get("RoleSessionName"))
+		f.mu.Unlock()
+		account := strings.Split(r.PostForm.Get("RoleArn"), ":")[4]
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+<AssumeRoleResult><Credentials>
+<AccessKeyId>ASIA%s</AccessKeyId>
+<SecretAccessKey>assumed-secret</SecretAccessKey>
+<SessionToken>assumed-session-token</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration>
+</Credentials><AssumedRoleUser><Arn>%s</Arn><AssumedRoleId>AROA:audit</AssumedRoleId></AssumedRoleUser>
+</AssumeRoleResult></AssumeRoleResponse>`, account, r.PostForm.Get("RoleArn"))
+	case "GetCallerIdentity":
+		fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+<GetCallerIdentityResult><Arn>arn:aws:iam::%[1]s:user/audit</Arn><UserId>AIDA</UserId><Account>%[1]s</Account></GetCallerIdentityResult>
+</GetCallerIdentityResponse>`, signingAccount(r))
+	case "GetAccountSummary":
+		mfa := 0
+		if signingAccount(r) == "111122223333" {
+			mfa = 1
+		}
+		fmt.Fprintf(w, `<GetAccountSummaryResponse><GetAccountSummaryResult><SummaryMap>
+<entry><key>AccountMFAEnabled</key><value>%d</value></entry>
+</SummaryMap></GetAccountSummaryResult></GetAccountSummaryResponse>`, mfa)
+	case "ListUsers":
+		fmt.Fprintf(w, `<ListUsersResponse><ListUsersResult><Users><member>
+<UserName>user-%[1]s</UserName><UserId>AIDA%[1]s</UserId><Path>/</Path>
+<Arn>arn:aws:iam::%[1]s:user/user-%[1]s</Arn><CreateDate>2020-01-01T00:00:00Z</CreateDate>
+</member></Users></ListUsersResult></ListUsersResponse>`, signingAccount(r))
+	case "ListUserTags", "ListMFADevices", "ListAccessKeys", "ListUserPolicies",
+		"ListAttachedUserPolicies", "ListPolicies":
+		fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult></%[1]sResult></%[1]sResponse>`, action)
+	case "GetLoginProfile":
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<ErrorResponse><Error><Code>NoSuchEntity</Code><Message>no login profile</Message></Error></ErrorResponse>`)
+	default:
+		http.Error(w, "unexpected action "+action, http.StatusBadRequest)
+	}
+}
+
+// setBaseCredentials makes the AWS SDK use static base credentials only
+func setBaseCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDBASE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "base-secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestNewAWSOrganizationRecordOmitsAssumedCredentials(t *testing.T) {
+	setBaseCredentials(t)
+
+	server := &fakeOrganizationServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	recordDir := t.TempDir()
+	a, err := NewAWS(context.Background(), Options{
+		Region:       "us-east-1",
+		Regions:      []string{"us-east-1"},
+		Endpoints:    Endpoints{URL: ts.URL},
+		Credentials:  CredentialOptions{SessionName: "compliance-audit"},
+		Organization: &OrganizationOptions{},
+		RecordDir:    recordDir,
+	})
+	if err != nil {
+		t.Fatalf("NewAWS() error = %v", err)
+	}
+	for _, m := range a.org.members {
+		if m.err != nil {
+			t.Errorf("member %s: %v", m.ID, m.err)
+		}
+	}
+
+	if want := []string{"compliance-audit"}; fmt.Sprint(server.sessionNames) != fmt.Sprint(want) {
+		t.Errorf("role session names = %v, want %v", server.sessionNames, want)
+	}
+
+	var recorded int
+	err = filepath.WalkDir(recordDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		recorded++
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, secret := range []string{"AssumeRole", "assumed-secret", "assumed-session-token"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("recording %s contains %q", path, secret)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded == 0 {
+		t.Fatal("no API calls were recorded")
+	}
+}
+
+func TestNewAWSOrganizationReplay(t *testing.T) {
+	setBaseCredentials(t)
+	ts := httptest.NewServer(&fakeOrganizationServer{})
+	defer ts.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	opts := Options{
+		Region:       "us-east-1",
+		Regions:      []string{"us-east-1"},
+		Endpoints:    Endpoints{URL: ts.URL},
+		Filter:       RuleFilter{Rules: []string{"AWS-IAM-003"}},
+		Organization: &OrganizationOptions{},
+	}
+	check := func(opts Options) (*Snapshot, []Result) {
+		t.Helper()
+		a, err := NewAWS(ctx, opts)
+		if err != nil {
+			t.Fatalf("NewAWS() error = %v", err)
+		}
+		s, err := a.Collect(ctx)
+		if err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		return s, a.Evaluate(s)
+	}
+
+	recordOpts := opts
+	recordOpts.RecordDir = dir
+	_, recorded := check(recordOpts)
+	if _, err := os.Stat(filepath.Join(dir, "222233334444")); err != nil {
+		t.Errorf("member account calls were not recorded separately: %v", err)
+	}
+
+	// Replaying must not reach the server.
+	ts.Close()
+	replayOpts := opts
+	replayOpts.ReplayDir = dir
+	snapshot, replayed := check(replayOpts)
+
+	for _, inv := range snapshot.Accounts {
+		var users []string
+		for _, u := range inv.IAM.Users {
+			users = append(users, aws.StringValue(u.User.UserName))
+		}
+		if want := []string{"user-" + inv.AccountID}; !reflect.DeepEqual(users, want) {
+			t.Errorf("users of %s = %v, want %v", inv.AccountID, users, want)
+		}
+	}
+	got := map[string]string{}
+	for _, r := range replayed {
+		got[r.Resource.AccountID+" "+r.Resource.Type+" "+r.Resource.Name] = string(r.Status)
+	}
+	want := map[string]string{
+		"111122223333 aws/iam-user root": string(StatusCompliant),
+		"222233334444 aws/iam-user root": string(StatusNonCompliant),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed results = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replayed results = %+v, want the recorded %+v", replayed, recorded)
+	}
+}
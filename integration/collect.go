@@ -0,0 +1,414 @@
+package integration
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/cloudtrail/cloudtrailiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// collector collects the inventory of one account. Every AWS API call is
+// made once per resource, however many rules use its response.
+type collector struct {
+	clients Clients
+	account awsAccount
+	// region is the region used for global API calls
+	region string
+	// regions are the regions whose regional resources are collected
+	regions []string
+	// services are the services collected
+	services []string
+	pool     *workerPool
+}
+
+// collect returns the inventory of c's account. Services are collected
+// concurrently; per-region and per-resource calls run on c's pool. Failed
+// calls are recorded in the inventory, so collect only fails if ctx is done.
+func (c *collector) collect(ctx context.Context) (*Inventory, error) {
+	inv := &Inventory{
+		AccountID:   c.account.ID,
+		Partition:   c.account.Partition,
+		CollectedAt: time.Now().UTC(),
+		Services:    c.services,
+	}
+	if contains(c.services, ServiceVPC) || contains(c.services, ServiceCloudTrail) {
+		for _, region := range c.regions {
+			inv.Regions = append(inv.Regions, RegionInventory{Region: region})
+		}
+	}
+
+	// Every service fills in its own part of inv.
+	collectors := map[string]func(context.Context, *Inventory) error{
+		ServiceIAM:        c.collectIAM,
+		ServiceS3:         c.collectS3,
+		ServiceVPC:        c.collectVPC,
+		ServiceCloudTrail: c.collectCloudTrail,
+	}
+	_, err := gather(ctx, len(c.services), func(ctx context.Context, i int) ([]struct{}, error) {
+		return nil, collectors[c.services[i]](ctx, inv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// collectIAM collects the account summary, users and customer managed
+// policies
+func (c *collector) collectIAM(ctx context.Context, inv *Inventory) error {
+	iamAPI := c.clients.IAM(c.region)
+
+	summary, err := iamAPI.GetAccountSummaryWithContext(ctx, &iam.GetAccountSummaryInput{})
+	if err != nil {
+		inv.IAM.AccountSummaryError = err.Error()
+	} else {
+		inv.IAM.AccountSummary = summary.SummaryMap
+	}
+
+	users, err := listUsers(ctx, iamAPI)
+	if err != nil {
+		inv.IAM.UsersError = err.Error()
+	}
+	inv.IAM.Users, err = run(ctx, c.pool, len(users), func(ctx context.Context, i int) ([]IAMUser, error) {
+		return []IAMUser{collectUser(ctx, iamAPI, users[i])}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	policies, err := listLocalPolicies(ctx, iamAPI)
+	if err != nil {
+		inv.IAM.PoliciesError = err.Error()
+	}
+	inv.IAM.Policies, err = run(ctx, c.pool, len(policies), func(ctx context.Context, i int) ([]IAMPolicy, error) {
+		p := IAMPolicy{Policy: policies[i]}
+		version, err := iamAPI.GetPolicyVersionWithContext(ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: policies[i].Arn,
+			VersionId: policies[i].DefaultVersionId,
+		})
+		if err != nil {
+			p.DefaultVersionError = err.Error()
+		} else {
+			p.DefaultVersion = version.PolicyVersion
+		}
+		return []IAMPolicy{p}, nil
+	})
+	return err
+}
+
+// collectUser collects the tags, credentials and policies of user
+func collectUser(ctx context.Context, iamAPI iamiface.IAMAPI, user *iam.User) IAMUser {
+	u := IAMUser{User: user}
+
+	// ListUsers does not return tags, so they are listed for each user.
+	tags, err := listUserTags(ctx, iamAPI, user.UserName)
+	u.TagsError = errString(err)
+	user.Tags = tags
+
+	u.MFADevices, err = listMFADevices(ctx, iamAPI, user.UserName)
+	u.MFAError = errString(err)
+
+	profile, err := iamAPI.GetLoginProfileWithContext(ctx, &iam.GetLoginProfileInput{UserName: user.UserName})
+	switch {
+	case isErrorCode(err, iam.ErrCodeNoSuchEntityException):
+		// The user has no console access.
+	case err != nil:
+		u.LoginProfileError = err.Error()
+	default:
+		u.LoginProfile = profile.LoginProfile
+	}
+
+	keys, err := listAccessKeys(ctx, iamAPI, user.UserName)
+	u.AccessKeysError = errString(err)
+	for _, key := range keys {
+		k := IAMAccessKey{Key: key}
+		// Only the last use of active keys matters.
+		if aws.StringValue(key.Status) == iam.StatusTypeActive {
+			out, err := iamAPI.GetAccessKeyLastUsedWithContext(ctx,
+				&iam.GetAccessKeyLastUsedInput{AccessKeyId: key.AccessKeyId})
+			if err != nil {
+				k.LastUsedError = err.Error()
+			} else {
+				k.LastUsed = out.AccessKeyLastUsed
+			}
+		}
+		u.AccessKeys = append(u.AccessKeys, k)
+	}
+
+	u.InlinePolicyNames, err = listUserPolicyNames(ctx, iamAPI, user.UserName)
+	u.InlinePoliciesError = errString(err)
+	u.AttachedPolicies, err = listAttachedUserPolicies(ctx, iamAPI, user.UserName)
+	u.AttachedPoliciesError = errString(err)
+	return u
+}
+
+// collectS3 collects every bucket with its region, tags and encryption
+func (c *collector) collectS3(ctx context.Context, inv *Inventory) error {
+	s3API := c.clients.S3(c.region)
+	buckets, err := s3API.ListBucketsWithContext(ctx, nil)
+	if err != nil {
+		inv.S3.BucketsError = err.Error()
+		return nil
+	}
+
+	inv.S3.Buckets, err = run(ctx, c.pool, len(buckets.Buckets), func(ctx context.Context, i int) ([]S3Bucket, error) {
+		return []S3Bucket{c.collectBucket(ctx, s3API, buckets.Buckets[i])}, nil
+	})
+	return err
+}
+
+// collectBucket collects the region, tags and encryption of bucket
+func (c *collector) collectBucket(ctx context.Context, s3API s3iface.S3API, bucket *s3.Bucket) S3Bucket {
+	b := S3Bucket{Bucket: bucket}
+
+	location, err := s3API.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: bucket.Name})
+	if err != nil {
+		b.LocationError = err.Error()
+		return b
+	}
+	b.Region = aws.StringValue(location.LocationConstraint)
+	if b.Region == "" {
+		// Buckets in Region us-east-1 have a LocationConstraint of null.
+		b.Region = "us-east-1"
+	}
+
+	// Bucket configuration can only be read from the bucket's region.
+	regionS3API := c.clients.S3(b.Region)
+
+	tagging, err := regionS3API.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: bucket.Name})
+	switch {
+	case isErrorCode(err, "NoSuchTagSet"):
+		b.Tags = s3Tags(nil)
+	case err != nil:
+		b.TagsError = err.Error()
+	default:
+		b.Tags = s3Tags(tagging.TagSet)
+	}
+
+	encryption, err := regionS3API.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{Bucket: bucket.Name})
+	switch {
+	case isErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError"):
+		// The bucket has no default encryption.
+	case err != nil:
+		b.EncryptionError = err.Error()
+	default:
+		b.Encryption = encryption.ServerSideEncryptionConfiguration
+	}
+	return b
+}
+
+// collectVPC collects the VPCs, security groups and flow logs of every region
+func (c *collector) collectVPC(ctx context.Context, inv *Inventory) error {
+	_, err := run(ctx, c.pool, len(inv.Regions), func(ctx context.Context, i int) ([]struct{}, error) {
+		r := &inv.Regions[i]
+		ec2API := c.clients.EC2(r.Region)
+
+		var err error
+		r.VPCs, err = describeVpcs(ctx, ec2API)
+		r.VPCsError = errString(err)
+		r.SecurityGroups, err = describeSecurityGroups(ctx, ec2API)
+		r.SecurityGroupsError = errString(err)
+		r.FlowLogs, err = describeFlowLogs(ctx, ec2API)
+		r.FlowLogsError = errString(err)
+		return nil, nil
+	})
+	return err
+}
+
+// collectCloudTrail collects the trails of every region with their tags and,
+// for multi-region trails, their event selectors
+func (c *collector) collectCloudTrail(ctx context.Context, inv *Inventory) error {
+	regionTrails, err := run(ctx, c.pool, len(inv.Regions), func(ctx context.Context, i int) ([]*cloudtrail.Trail, error) {
+		r := &inv.Regions[i]
+		// DescribeTrails is not paginated; it returns every trail at once.
+		out, err := c.clients.CloudTrail(r.Region).DescribeTrailsWithContext(ctx, nil)
+		if err != nil {
+			r.TrailsError = err.Error()
+			return nil, nil
+		}
+		return out.TrailList, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Multi-region trails are listed in every region.
+	var trails []*cloudtrail.Trail
+	seen := map[string]bool{}
+	for _, trail := range regionTrails {
+		if arn := aws.StringValue(trail.TrailARN); !seen[arn] {
+			seen[arn] = true
+			trails = append(trails, trail)
+		}
+	}
+
+	inv.CloudTrail.Trails, err = run(ctx, c.pool, len(trails), func(ctx context.Context, i int) ([]CloudTrailTrail, error) {
+		return []CloudTrailTrail{c.collectTrail(ctx, trails[i])}, nil
+	})
+	return err
+}
+
+// collectTrail collects the tags and, for a multi-region trail, the event
+// selectors of trail
+func (c *collector) collectTrail(ctx context.Context, trail *cloudtrail.Trail) CloudTrailTrail {
+	t := CloudTrailTrail{Trail: trail}
+
+	// ListTags only accepts trails in the region of the client.
+	region := aws.StringValue(trail.HomeRegion)
+	if region == "" {
+		region = c.region
+	}
+	homeCloudTrailAPI := c.clients.CloudTrail(region)
+
+	tags, err := listTrailTags(ctx, homeCloudTrailAPI, trail.TrailARN)
+	if err != nil {
+		t.TagsError = err.Error()
+	} else {
+		t.Tags = cloudTrailTags(tags)
+	}
+
+	if aws.BoolValue(trail.IsMultiRegionTrail) {
+		selectors, err := homeCloudTrailAPI.GetEventSelectorsWithContext(ctx,
+			&cloudtrail.GetEventSelectorsInput{TrailName: trail.TrailARN})
+		if err != nil {
+			t.EventSelectorsError = err.Error()
+		} else {
+			t.EventSelectors = selectors.EventSelectors
+		}
+	}
+	return t
+}
+
+// listUsers returns every IAM user
+func listUsers(ctx context.Context, iamAPI iamiface.IAMAPI) ([]*iam.User, error) {
+	var users []*iam.User
+	err := iamAPI.ListUsersPagesWithContext(ctx, &iam.ListUsersInput{},
+		func(page *iam.ListUsersOutput, _ bool) bool {
+			users = append(users, page.Users...)
+			return true
+		})
+	return users, err
+}
+
+// listUserTags returns every tag of the given user
+func listUserTags(ctx context.Context, iamAPI iamiface.IAMAPI, userName *string) ([]*iam.Tag, error) {
+	var tags []*iam.Tag
+	err := iamAPI.ListUserTagsPagesWithContext(ctx, &iam.ListUserTagsInput{UserName: userName},
+		func(page *iam.ListUserTagsOutput, _ bool) bool {
+			tags = append(tags, page.Tags...)
+			return true
+		})
+	return tags, err
+}
+
+// listMFADevices returns every MFA device of the given user
+func listMFADevices(ctx context.Context, iamAPI iamiface.IAMAPI, userName *string) ([]*iam.MFADevice, error) {
+	var devices []*iam.MFADevice
+	err := iamAPI.ListMFADevicesPagesWithContext(ctx, &iam.ListMFADevicesInput{UserName: userName},
+		func(page *iam.ListMFADevicesOutput, _ bool) bool {
+			devices = append(devices, page.MFADevices...)
+			return true
+		})
+	return devices, err
+}
+
+// listAccessKeys returns every access key of the given user
+func listAccessKeys(ctx context.Context, iamAPI iamiface.IAMAPI, userName *string) ([]*iam.AccessKeyMetadata, error) {
+	var keys []*iam.AccessKeyMetadata
+	err := iamAPI.ListAccessKeysPagesWithContext(ctx, &iam.ListAccessKeysInput{UserName: userName},
+		func(page *iam.ListAccessKeysOutput, _ bool) bool {
+			keys = append(keys, page.AccessKeyMetadata...)
+			return true
+		})
+	return keys, err
+}
+
+// listLocalPolicies returns every customer managed policy
+func listLocalPolicies(ctx context.Context, iamAPI iamiface.IAMAPI) ([]*iam.Policy, error) {
+	var policies []*iam.Policy
+	err := iamAPI.ListPoliciesPagesWithContext(ctx, &iam.ListPoliciesInput{Scope: aws.String("Local")},
+		func(page *iam.ListPoliciesOutput, _ bool) bool {
+			policies = append(policies, page.Policies...)
+			return true
+		})
+	return policies, err
+}
+
+// listUserPolicyNames returns the names of every inline policy of the given
+// user
+func listUserPolicyNames(ctx context.Context, iamAPI iamiface.IAMAPI, userName *string) ([]*string, error) {
+	var names []*string
+	err := iamAPI.ListUserPoliciesPagesWithContext(ctx, &iam.ListUserPoliciesInput{UserName: userName},
+		func(page *iam.ListUserPoliciesOutput, _ bool) bool {
+			names = append(names, page.PolicyNames...)
+			return true
+		})
+	return names, err
+}
+
+// listAttachedUserPolicies returns every managed policy attached to the given
+// user
+func listAttachedUserPolicies(ctx context.Context, iamAPI iamiface.IAMAPI, userName *string) ([]*iam.AttachedPolicy, error) {
+	var policies []*iam.AttachedPolicy
+	err := iamAPI.ListAttachedUserPoliciesPagesWithContext(ctx, &iam.ListAttachedUserPoliciesInput{UserName: userName},
+		func(page *iam.ListAttachedUserPoliciesOutput, _ bool) bool {
+			policies = append(policies, page.AttachedPolicies...)
+			return true
+		})
+	return policies, err
+}
+
+// describeVpcs returns every VPC visible to ec2API
+func describeVpcs(ctx context.Context, ec2API ec2iface.EC2API) ([]*ec2.Vpc, error) {
+	var vpcs []*ec2.Vpc
+	err := ec2API.DescribeVpcsPagesWithContext(ctx, &ec2.DescribeVpcsInput{},
+		func(page *ec2.DescribeVpcsOutput, _ bool) bool {
+			vpcs = append(vpcs, page.Vpcs...)
+			return true
+		})
+	return vpcs, err
+}
+
+// describeSecurityGroups returns every security group visible to ec2API
+func describeSecurityGroups(ctx context.Context, ec2API ec2iface.EC2API) ([]*ec2.SecurityGroup, error) {
+	var sgs []*ec2.SecurityGroup
+	err := ec2API.DescribeSecurityGroupsPagesWithContext(ctx, &ec2.DescribeSecurityGroupsInput{},
+		func(page *ec2.DescribeSecurityGroupsOutput, _ bool) bool {
+			sgs = append(sgs, page.SecurityGroups...)
+			return true
+		})
+	return sgs, err
+}
+
+// describeFlowLogs returns every flow log visible to ec2API
+func describeFlowLogs(ctx context.Context, ec2API ec2iface.EC2API) ([]*ec2.FlowLog, error) {
+	var flowLogs []*ec2.FlowLog
+	err := ec2API.DescribeFlowLogsPagesWithContext(ctx, &ec2.DescribeFlowLogsInput{},
+		func(page *ec2.DescribeFlowLogsOutput, _ bool) bool {
+			flowLogs = append(flowLogs, page.FlowLogs...)
+			return true
+		})
+	return flowLogs, err
+}
+
+// listTrailTags returns every tag of the trail with the given ARN
+func listTrailTags(ctx context.Context, cloudTrailAPI cloudtrailiface.CloudTrailAPI, trailARN *string) ([]*cloudtrail.Tag, error) {
+	var tags []*cloudtrail.Tag
+	err := cloudTrailAPI.ListTagsPagesWithContext(ctx,
+		&cloudtrail.ListTagsInput{ResourceIdList: []*string{trailARN}},
+		func(page *cloudtrail.ListTagsOutput, _ bool) bool {
+			for _, rt := range page.ResourceTagList {
+				tags = append(tags, rt.TagsList...)
+			}
+			return true
+		})
+	return tags, err
+}
@@ -0,0 +1,90 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestCollectPaginated(t *testing.T) {
+	f := newFakeClients()
+	user := func(name string) *iam.User {
+		return &iam.User{UserName: aws.String(name), Arn: aws.String("arn:aws:iam::" + testAccountID + ":user/" + name)}
+	}
+	f.iam.users = [][]*iam.User{{user("page1-user")}, {user("page2-user")}}
+	key := func(id string) *iam.AccessKeyMetadata {
+		return &iam.AccessKeyMetadata{AccessKeyId: aws.String(id), Status: aws.String(iam.StatusTypeActive)}
+	}
+	f.iam.accessKeys["page1-user"] = [][]*iam.AccessKeyMetadata{{key("AKIAPAGE1")}, {key("AKIAPAGE2")}}
+	f.iam.lastUsed["AKIAPAGE2"] = &iam.AccessKeyLastUsed{LastUsedDate: aws.Time(time.Now().AddDate(-1, 0, 0))}
+	policy := func(name string) *iam.Policy {
+		arn := "arn:aws:iam::" + testAccountID + ":policy/" + name
+		f.iam.policyVersions[arn] = &iam.PolicyVersion{Document: aws.String(adminPolicy)}
+		return &iam.Policy{PolicyName: aws.String(name), Arn: aws.String(arn), DefaultVersionId: aws.String("v1")}
+	}
+	f.iam.policies = [][]*iam.Policy{{policy("page1-policy")}, {policy("page2-policy")}}
+
+	vpc := func(id string) *ec2.Vpc { return &ec2.Vpc{VpcId: aws.String(id), OwnerId: aws.String(testAccountID)} }
+	f.ec2.vpcs = [][]*ec2.Vpc{{vpc("vpc-page1")}, {vpc("vpc-page2")}}
+	sg := func(id string) *ec2.SecurityGroup {
+		return &ec2.SecurityGroup{
+			GroupId:       aws.String(id),
+			GroupName:     aws.String(id),
+			VpcId:         aws.String("vpc-page1"),
+			OwnerId:       aws.String(testAccountID),
+			IpPermissions: []*ec2.IpPermission{sshFrom("0.0.0.0/0")},
+		}
+	}
+	f.ec2.securityGroups = [][]*ec2.SecurityGroup{{sg("sg-page1")}, {sg("sg-page2")}}
+	flowLog := func(vpc string) *ec2.FlowLog { return &ec2.FlowLog{ResourceId: aws.String(vpc)} }
+	f.ec2.flowLogs = [][]*ec2.FlowLog{{flowLog("vpc-other")}, {flowLog("vpc-page2")}}
+
+	ctx := context.Background()
+	a, err := newFakeAWS(ctx, f, "AWS-IAM-002", "AWS-IAM-005", "AWS-IAM-006", "AWS-VPC-001", "AWS-VPC-003")
+	if err != nil {
+		t.Fatalf("NewAWSWithClients() error = %v", err)
+	}
+	res, err := a.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	got := map[string]map[string]Status{}
+	for _, r := range res {
+		if got[r.RuleID] == nil {
+			got[r.RuleID] = map[string]Status{}
+		}
+		got[r.RuleID][r.Resource.Name] = r.Status
+	}
+	tests := []struct {
+		api      string
+		rule     string
+		resource string
+		want     Status
+	}{
+		{"ListUsers", "AWS-IAM-006", "page1-user", StatusCompliant},
+		{"ListUsers", "AWS-IAM-006", "page2-user", StatusCompliant},
+		{"ListAccessKeys", "AWS-IAM-002", "AKIAPAGE1", StatusCompliant},
+		{"ListAccessKeys", "AWS-IAM-002", "AKIAPAGE2", StatusNonCompliant},
+		{"ListPolicies", "AWS-IAM-005", "page1-policy", StatusNonCompliant},
+		{"ListPolicies", "AWS-IAM-005", "page2-policy", StatusNonCompliant},
+		{"DescribeVpcs", "AWS-VPC-001", "vpc-page1", StatusNonCompliant},
+		// The flow log of vpc-page2 is on the second page.
+		{"DescribeFlowLogs", "AWS-VPC-001", "vpc-page2", StatusCompliant},
+		{"DescribeSecurityGroups", "AWS-VPC-003", "sg-page1", StatusNonCompliant},
+		{"DescribeSecurityGroups", "AWS-VPC-003", "sg-page2", StatusNonCompliant},
+	}
+	for _, tt := range tests {
+		status, ok := got[tt.rule][tt.resource]
+		switch {
+		case !ok:
+			t.Errorf("%s: no %s result of %s", tt.api, tt.rule, tt.resource)
+		case status != tt.want:
+			t.Errorf("%s: %s result of %s is %s, want %s", tt.api, tt.rule, tt.resource, status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// defaultSessionName is the role session name used when none is given
+const defaultSessionName = "plio"
+
+// CredentialOptions configures where the AWS credentials come from. The zero
+// value uses the SDK's default credential chain.
+type CredentialOptions struct {
+	// Profile is the shared config profile to use, including its role_arn,
+	// source_profile and mfa_serial settings
+	Profile string
+	// RoleARN, if set, is a role assumed with the base credentials, or with
+	// WebIdentityTokenFile if set
+	RoleARN string
+	// ExternalID is passed when assuming RoleARN
+	ExternalID string
+	// MFASerial is the serial number or ARN of the MFA device required to
+	// assume RoleARN. The MFA code is read from stdin.
+	MFASerial string
+	// SessionName is the role session name, which shows up in CloudTrail
+	SessionName string
+	// Duration is how long assumed role credentials are valid for before they
+	// are refreshed. Zero means the STS default.
+	Duration time.Duration
+	// WebIdentityTokenFile, if set, is a file containing an OIDC token, e.g.
+	// from a CI provider, exchanged for the credentials of RoleARN
+	WebIdentityTokenFile string
+}
+
+// Validate checks that o is consistent
+func (o CredentialOptions) Validate() error {
+	if o.RoleARN == "" {
+		switch {
+		case o.ExternalID != "":
+			return errors.New("external ID requires a role ARN")
+		case o.MFASerial != "":
+			return errors.New("MFA serial requires a role ARN")
+		case o.WebIdentityTokenFile != "":
+			return errors.New("web identity token file requires a role ARN")
+		}
+	}
+	if o.WebIdentityTokenFile != "" && (o.ExternalID != "" || o.MFASerial != "") {
+		return errors.New("web identity credentials support neither an external ID nor MFA")
+	}
+	if o.Duration < 0 {
+		return errors.New("role session duration must not be negative")
+	}
+	return nil
+}
+
+// newSession returns a session configured by cfg that uses the credentials
+// selected by o. Every client created from the session inherits them.
+func (o CredentialOptions) newSession(cfg *aws.Config) (*session.Session, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	s, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		Profile:           o.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+		// Profiles with mfa_serial prompt for the MFA code.
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if o.RoleARN == "" {
+		return s, nil
+	}
+
+	sessionName := o.sessionName()
+	var creds *credentials.Credentials
+	if o.WebIdentityTokenFile != "" {
+		creds = credentials.NewCredentials(stscreds.NewWebIdentityRoleProviderWithOptions(
+			sts.New(s), o.RoleARN, sessionName, stscreds.FetchTokenPath(o.WebIdentityTokenFile),
+			func(p *stscreds.WebIdentityRoleProvider) {
+				p.Duration = o.Duration
+			}))
+	} else {
+		creds = stscreds.NewCredentials(s, o.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = sessionName
+			if o.Duration > 0 {
+				p.Duration = o.Duration
+			}
+			if o.ExternalID != "" {
+				p.ExternalID = aws.String(o.ExternalID)
+			}
+			if o.MFASerial != "" {
+				p.SerialNumber = aws.String(o.MFASerial)
+				p.TokenProvider = stscreds.StdinTokenProvider
+			}
+		})
+	}
+	return s.Copy(aws.NewConfig().WithCredentials(creds)), nil
+}
+
+// sessionName returns the role session name of o, defaulting to
+// defaultSessionName
+func (o CredentialOptions) sessionName() string {
+	if o.SessionName == "" {
+		return defaultSessionName
+	}
+	return o.SessionName
+}
@@ -0,0 +1,200 @@
+package integration
+
+import "sort"
+
+// Diff is the difference between the results of two scans. Results are
+// matched by rule ID and resource ID.
+type Diff struct {
+	// NewFindings are non-compliant in head but were not in base
+	NewFindings []Result `json:"new_findings"`
+	// FixedFindings are non-compliant in base, and compliant in head or no
+	// longer found although their rule was checked in their account. The
+	// results are those of base.
+	FixedFindings []Result `json:"fixed_findings"`
+	// PersistingFindings are non-compliant in both scans. The results are
+	// those of head.
+	PersistingFindings []Result `json:"persisting_findings"`
+	// AppearedResources are checked by head but not by base
+	AppearedResources []Resource `json:"appeared_resources"`
+	// DisappearedResources are checked by base but not by head
+	DisappearedResources []Resource `json:"disappeared_resources"`
+	// Rules are the rules whose pass rate changed, ordered by rule ID
+	Rules []RuleDiff `json:"rules"`
+}
+
+// RuleDiff is the change of the pass rate of a rule between two scans
+type RuleDiff struct {
+	RuleID string `json:"rule_id"`
+	// Base and Head are the rule's pass rate in each scan. They are nil if
+	// the scan did not check the rule.
+	Base *PassRate `json:"base"`
+	Head *PassRate `json:"head"`
+}
+
+// PassRate is the share of the results of a rule that are compliant
+type PassRate struct {
+	// Passed counts compliant results
+	Passed int `json:"passed"`
+	// Checked counts results that are not errors. Waived results are
+	// checked, but do not pass.
+	Checked int `json:"checked"`
+	// Rate is Passed / Checked
+	Rate float64 `json:"rate"`
+}
+
+// resultKey identifies the result of a rule for a resource across scans
+type resultKey struct {
+	ruleID     string
+	resourceID string
+}
+
+// statusRank orders statuses from best to worst when combining results
+var statusRank = map[Status]int{
+	StatusCompliant:    0,
+	StatusError:        1,
+	StatusWaived:       2,
+	StatusNonCompliant: 3,
+}
+
+// MergeResults combines the results of a rule for the same resource into the
+// one with the worst status, in the order the results first appear. A
+// resource can be checked more than once by a scan, e.g. an organization
+// trail is checked in every member account. A finding is worse than an
+// error, which is worse than a compliant result since it may hide a finding.
+func MergeResults(results []Result) []Result {
+	merged := make([]Result, 0, len(results))
+	index := map[resultKey]int{}
+	for _, res := range results {
+		k := resultKey{res.RuleID, res.Resource.ID()}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(merged)
+			merged = append(merged, res)
+			continue
+		}
+		if statusRank[res.Status] > statusRank[merged[i].Status] {
+			merged[i] = res
+		}
+	}
+	return merged
+}
+
+// ruleAccount identifies the results of a rule in an account
+type ruleAccount struct {
+	ruleID    string
+	accountID string
+}
+
+// scanResults indexes the results of a scan
+type scanResults struct {
+	results map[resultKey]Result
+	// checked holds the rules checked in every account, i.e. that have a
+	// result other than an error
+	checked map[ruleAccount]bool
+	// resources maps the IDs of the resources checked to the resources
+	resources map[string]Resource
+	rates     map[string]*PassRate
+}
+
+// indexResults indexes the results of a scan
+func indexResults(results []Result) scanResults {
+	s := scanResults{
+		results:   map[resultKey]Result{},
+		checked:   map[ruleAccount]bool{},
+		resources: map[string]Resource{},
+		rates:     map[string]*PassRate{},
+	}
+	for _, res := range results {
+		s.results[resultKey{res.RuleID, res.Resource.ID()}] = res
+		if res.Status == StatusError {
+			continue
+		}
+		s.checked[ruleAccount{res.RuleID, res.Resource.AccountID}] = true
+		s.resources[res.Resource.ID()] = res.Resource
+
+		rate, ok := s.rates[res.RuleID]
+		if !ok {
+			rate = &PassRate{}
+			s.rates[res.RuleID] = rate
+		}
+		rate.Checked++
+		if res.Status == StatusCompliant {
+			rate.Passed++
+		}
+		rate.Rate = float64(rate.Passed) / float64(rate.Checked)
+	}
+	return s
+}
+
+// NewDiff returns the difference between the results of the scans base and
+// head. Results that are errors are neither findings nor fixes, and only
+// resources checked without errors appear or disappear. The results of each
+// scan are first combined by MergeResults.
+func NewDiff(base, head []Result) *Diff {
+	d := &Diff{
+		NewFindings:        []Result{},
+		FixedFindings:      []Result{},
+		PersistingFindings: []Result{},
+		Rules:              []RuleDiff{},
+	}
+	base, head = MergeResults(base), MergeResults(head)
+	b, h := indexResults(base), indexResults(head)
+
+	for _, res := range head {
+		if res.Status != StatusNonCompliant {
+			continue
+		}
+		if b.results[resultKey{res.RuleID, res.Resource.ID()}].Status == StatusNonCompliant {
+			d.PersistingFindings = append(d.PersistingFindings, res)
+		} else {
+			d.NewFindings = append(d.NewFindings, res)
+		}
+	}
+	for _, res := range base {
+		if res.Status != StatusNonCompliant {
+			continue
+		}
+		headRes, ok := h.results[resultKey{res.RuleID, res.Resource.ID()}]
+		if ok && headRes.Status == StatusCompliant || !ok && h.checked[ruleAccount{res.RuleID, res.Resource.AccountID}] {
+			d.FixedFindings = append(d.FixedFindings, res)
+		}
+	}
+
+	d.AppearedResources = resourcesMissing(head, h, b)
+	d.DisappearedResources = resourcesMissing(base, b, h)
+
+	ruleIDs := map[string]bool{}
+	for id := range b.rates {
+		ruleIDs[id] = true
+	}
+	for id := range h.rates {
+		ruleIDs[id] = true
+	}
+	for id := range ruleIDs {
+		baseRate, headRate := b.rates[id], h.rates[id]
+		if baseRate != nil && headRate != nil && baseRate.Rate == headRate.Rate {
+			continue
+		}
+		d.Rules = append(d.Rules, RuleDiff{RuleID: id, Base: baseRate, Head: headRate})
+	}
+	sort.Slice(d.Rules, func(i, j int) bool { return d.Rules[i].RuleID < d.Rules[j].RuleID })
+	return d
+}
+
+// resourcesMissing returns the resources checked by results, indexed by s,
+// that other did not check, in the order of results
+func resourcesMissing(results []Result, s, other scanResults) []Resource {
+	resources := []Resource{}
+	seen := map[string]bool{}
+	for _, res := range results {
+		id := res.Resource.ID()
+		if _, ok := s.resources[id]; !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, ok := other.resources[id]; !ok {
+			resources = append(resources, res.Resource)
+		}
+	}
+	return resources
+}
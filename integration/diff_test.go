@@ -0,0 +1,172 @@
+package integration
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testResult returns a result of rule for the resource named name in
+// account, with the given status
+func testResult(rule, account, name string, status Status) Result {
+	return Result{
+		RuleID: rule,
+		Resource: Resource{
+			Type:      "aws/s3-bucket",
+			Name:      name,
+			AccountID: account,
+		},
+		Status:    status,
+		Compliant: status == StatusCompliant,
+	}
+}
+
+// orgTrailResult returns a result of rule for the organization trail as
+// checked in account
+func orgTrailResult(rule, account string, status Status) Result {
+	return Result{
+		RuleID: rule,
+		Resource: Resource{
+			Type:      "aws/cloudtrail",
+			Name:      "org-trail",
+			ARN:       "arn:aws:cloudtrail:us-east-1:111122223333:trail/org-trail",
+			AccountID: account,
+			Region:    "us-east-1",
+		},
+		Status:    status,
+		Compliant: status == StatusCompliant,
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []Result
+		want    []Result
+	}{
+		{
+			name: "distinct results are kept in order",
+			results: []Result{
+				testResult("AWS-S3-001", "1", "b", StatusCompliant),
+				testResult("AWS-S3-001", "1", "a", StatusNonCompliant),
+				testResult("AWS-S3-002", "1", "a", StatusError),
+			},
+			want: []Result{
+				testResult("AWS-S3-001", "1", "b", StatusCompliant),
+				testResult("AWS-S3-001", "1", "a", StatusNonCompliant),
+				testResult("AWS-S3-002", "1", "a", StatusError),
+			},
+		},
+		{
+			name: "finding wins over compliant",
+			results: []Result{
+				orgTrailResult("AWS-CT-001", "1", StatusCompliant),
+				testResult("AWS-S3-001", "1", "a", StatusCompliant),
+				orgTrailResult("AWS-CT-001", "2", StatusNonCompliant),
+			},
+			want: []Result{
+				orgTrailResult("AWS-CT-001", "2", StatusNonCompliant),
+				testResult("AWS-S3-001", "1", "a", StatusCompliant),
+			},
+		},
+		{
+			name: "finding wins over waived and error",
+			results: []Result{
+				orgTrailResult("AWS-CT-001", "1", StatusNonCompliant),
+				orgTrailResult("AWS-CT-001", "2", StatusWaived),
+				orgTrailResult("AWS-CT-001", "3", StatusError),
+			},
+			want: []Result{orgTrailResult("AWS-CT-001", "1", StatusNonCompliant)},
+		},
+		{
+			name: "error wins over compliant",
+			results: []Result{
+				orgTrailResult("AWS-CT-001", "1", StatusCompliant),
+				orgTrailResult("AWS-CT-001", "2", StatusError),
+				orgTrailResult("AWS-CT-001", "3", StatusCompliant),
+			},
+			want: []Result{orgTrailResult("AWS-CT-001", "2", StatusError)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeResults(tt.results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDiff(t *testing.T) {
+	tests := []struct {
+		name           string
+		base, head     []Result
+		wantNew        []Result
+		wantFixed      []Result
+		wantPersisting []Result
+	}{
+		{
+			name: "identical scans with a resource checked in several accounts",
+			base: []Result{
+				orgTrailResult("AWS-CT-001", "1", StatusNonCompliant),
+				orgTrailResult("AWS-CT-001", "2", StatusCompliant),
+			},
+			head: []Result{
+				orgTrailResult("AWS-CT-001", "1", StatusNonCompliant),
+				orgTrailResult("AWS-CT-001", "2", StatusCompliant),
+			},
+			wantPersisting: []Result{orgTrailResult("AWS-CT-001", "1", StatusNonCompliant)},
+		},
+		{
+			name: "new, fixed and persisting findings",
+			base: []Result{
+				testResult("AWS-S3-001", "1", "fixed", StatusNonCompliant),
+				testResult("AWS-S3-001", "1", "kept", StatusNonCompliant),
+				testResult("AWS-S3-001", "1", "new", StatusCompliant),
+				testResult("AWS-S3-001", "1", "deleted", StatusNonCompliant),
+			},
+			head: []Result{
+				testResult("AWS-S3-001", "1", "fixed", StatusCompliant),
+				testResult("AWS-S3-001", "1", "kept", StatusNonCompliant),
+				testResult("AWS-S3-001", "1", "new", StatusNonCompliant),
+			},
+			wantNew: []Result{testResult("AWS-S3-001", "1", "new", StatusNonCompliant)},
+			wantFixed: []Result{
+				testResult("AWS-S3-001", "1", "fixed", StatusNonCompliant),
+				testResult("AWS-S3-001", "1", "deleted", StatusNonCompliant),
+			},
+			wantPersisting: []Result{testResult("AWS-S3-001", "1", "kept", StatusNonCompliant)},
+		},
+		{
+			name: "errors do not fix findings",
+			base: []Result{testResult("AWS-S3-001", "1", "a", StatusNonCompliant)},
+			head: []Result{testResult("AWS-S3-001", "1", "a", StatusError)},
+		},
+		{
+			name: "findings of rules not checked in head are not fixed",
+			base: []Result{testResult("AWS-S3-001", "1", "a", StatusNonCompliant)},
+			head: []Result{testResult("AWS-S3-001", "2", "b", StatusCompliant)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDiff(tt.base, tt.head)
+			for _, c := range []struct {
+				kind      string
+				got, want []Result
+			}{
+				{"new", d.NewFindings, tt.wantNew},
+				{"fixed", d.FixedFindings, tt.wantFixed},
+				{"persisting", d.PersistingFindings, tt.wantPersisting},
+			} {
+				if len(c.got) == 0 && len(c.want) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(c.got, c.want) {
+					t.Errorf("%s findings = %+v, want %+v", c.kind, c.got, c.want)
+				}
+			}
+		})
+	}
+}
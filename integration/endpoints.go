@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// endpointServices lists the services whose endpoints can be overridden, by
+// the SDK's endpoint ID
+var endpointServices = []string{
+	cloudtrail.EndpointsID,
+	ec2.EndpointsID,
+	iam.EndpointsID,
+	organizations.EndpointsID,
+	s3.EndpointsID,
+	sts.EndpointsID,
+}
+
+// Endpoints overrides the AWS API endpoints, e.g. to run against LocalStack
+// or moto. The zero value uses the real AWS endpoints.
+type Endpoints struct {
+	// URL, if set, is the endpoint of every service without an override in
+	// Services, including the STS calls that fetch credentials
+	URL string `yaml:"url"`
+	// Services overrides the endpoints of individual services by endpoint
+	// ID, e.g. s3 or ec2
+	Services map[string]string `yaml:"services"`
+}
+
+// Validate checks that every endpoint is an absolute URL of a known service
+func (e Endpoints) Validate() error {
+	if e.URL != "" {
+		if err := validateEndpointURL(e.URL); err != nil {
+			return err
+		}
+	}
+	for service, u := range e.Services {
+		if !contains(endpointServices, service) {
+			return fmt.Errorf("unknown endpoint service %q, must be one of %v", service, endpointServices)
+		}
+		if err := validateEndpointURL(u); err != nil {
+			return fmt.Errorf("%s: %w", service, err)
+		}
+	}
+	return nil
+}
+
+func validateEndpointURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL %q: %w", s, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("endpoint URL %q must include a scheme and host, e.g. http://localhost:4566", s)
+	}
+	return nil
+}
+
+// lookup returns the endpoint of service, or "" to use the real endpoint
+func (e Endpoints) lookup(service string) string {
+	if u, ok := e.Services[service]; ok {
+		return u
+	}
+	return e.URL
+}
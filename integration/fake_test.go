@@ -0,0 +1,512 @@
+package integration
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/cloudtrail/cloudtrailiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+const (
+	testAccountID = "111122223333"
+	testRegion    = "us-east-1"
+)
+
+// fakeClients are Clients whose clients answer from in-memory resources.
+// The same clients serve every region. Calls of operations that are not
+// implemented panic.
+type fakeClients struct {
+	errs       fakeErrors
+	iam        *fakeIAM
+	s3         *fakeS3
+	ec2        *fakeEC2
+	cloudTrail *fakeCloudTrail
+	sts        *fakeSTS
+}
+
+// newFakeClients returns fakeClients of an account without resources
+func newFakeClients() *fakeClients {
+	errs := fakeErrors{}
+	return &fakeClients{
+		errs: errs,
+		iam: &fakeIAM{
+			fakeErrors:     errs,
+			summary:        map[string]*int64{},
+			userTags:       map[string][]*iam.Tag{},
+			mfaDevices:     map[string][]*iam.MFADevice{},
+			loginProfiles:  map[string]*iam.LoginProfile{},
+			accessKeys:     map[string][][]*iam.AccessKeyMetadata{},
+			lastUsed:       map[string]*iam.AccessKeyLastUsed{},
+			policyVersions: map[string]*iam.PolicyVersion{},
+			inlinePolicies: map[string][]*string{},
+			attached:       map[string][]*iam.AttachedPolicy{},
+		},
+		s3: &fakeS3{
+			fakeErrors: errs,
+			locations:  map[string]string{},
+			tags:       map[string][]*s3.Tag{},
+			encryption: map[string]*s3.ServerSideEncryptionConfiguration{},
+		},
+		ec2: &fakeEC2{fakeErrors: errs},
+		cloudTrail: &fakeCloudTrail{
+			fakeErrors: errs,
+			selectors:  map[string][]*cloudtrail.EventSelector{},
+			tags:       map[string][]*cloudtrail.Tag{},
+		},
+		sts: &fakeSTS{fakeErrors: errs},
+	}
+}
+
+func (c *fakeClients) IAM(string) iamiface.IAMAPI                               { return c.iam }
+func (c *fakeClients) S3(string) s3iface.S3API                                  { return c.s3 }
+func (c *fakeClients) EC2(string) ec2iface.EC2API                               { return c.ec2 }
+func (c *fakeClients) CloudTrail(string) cloudtrailiface.CloudTrailAPI          { return c.cloudTrail }
+func (c *fakeClients) STS(string) stsiface.STSAPI                               { return c.sts }
+func (c *fakeClients) Organizations(string) organizationsiface.OrganizationsAPI { return nil }
+func (c *fakeClients) AssumeRole(string, string) Clients                        { return c }
+
+// fail makes every call of the operation op, e.g. ListUsers, fail
+func (c *fakeClients) fail(op string) {
+	c.errs[op] = awserr.New("AccessDenied", "not authorized to perform "+op, nil)
+}
+
+// fakeErrors maps the operations that fail to their errors. It is shared by
+// the fake clients of an account.
+type fakeErrors map[string]error
+
+func (e fakeErrors) err(op string) error {
+	return e[op]
+}
+
+// fakeCalls records the inputs of the calls changing resources
+type fakeCalls struct {
+	mu    sync.Mutex
+	calls []interface{}
+}
+
+func (c *fakeCalls) record(input interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, input)
+}
+
+// fakeIAM is an iamiface.IAMAPI of users, their credentials and policies,
+// and customer managed policies, keyed by user name and policy ARN
+type fakeIAM struct {
+	iamiface.IAMAPI
+	fakeErrors
+	fakeCalls
+
+	summary map[string]*int64
+	// users and policies are listed one page at a time
+	users          [][]*iam.User
+	userTags       map[string][]*iam.Tag
+	mfaDevices     map[string][]*iam.MFADevice
+	loginProfiles  map[string]*iam.LoginProfile
+	accessKeys     map[string][][]*iam.AccessKeyMetadata
+	lastUsed       map[string]*iam.AccessKeyLastUsed
+	policies       [][]*iam.Policy
+	policyVersions map[string]*iam.PolicyVersion
+	inlinePolicies map[string][]*string
+	attached       map[string][]*iam.AttachedPolicy
+}
+
+// addUser adds a user without credentials or policies
+func (f *fakeIAM) addUser(name string) {
+	f.users = append(f.users, []*iam.User{{
+		UserName: aws.String(name),
+		Arn:      aws.String("arn:aws:iam::" + testAccountID + ":user/" + name),
+	}})
+}
+
+// addPolicy adds a customer managed policy whose default version is document
+func (f *fakeIAM) addPolicy(name, document string) {
+	arn := "arn:aws:iam::" + testAccountID + ":policy/" + name
+	f.policies = append(f.policies, []*iam.Policy{{
+		PolicyName:       aws.String(name),
+		Arn:              aws.String(arn),
+		DefaultVersionId: aws.String("v1"),
+	}})
+	f.policyVersions[arn] = &iam.PolicyVersion{Document: aws.String(document), VersionId: aws.String("v1")}
+}
+
+func (f *fakeIAM) GetAccountSummaryWithContext(aws.Context, *iam.GetAccountSummaryInput, ...request.Option) (*iam.GetAccountSummaryOutput, error) {
+	if err := f.err("GetAccountSummary"); err != nil {
+		return nil, err
+	}
+	return &iam.GetAccountSummaryOutput{SummaryMap: f.summary}, nil
+}
+
+func (f *fakeIAM) ListUsersPagesWithContext(_ aws.Context, _ *iam.ListUsersInput, fn func(*iam.ListUsersOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListUsers"); err != nil {
+		return err
+	}
+	for i, page := range f.users {
+		if !fn(&iam.ListUsersOutput{Users: page}, i == len(f.users)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeIAM) ListUserTagsPagesWithContext(_ aws.Context, in *iam.ListUserTagsInput, fn func(*iam.ListUserTagsOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListUserTags"); err != nil {
+		return err
+	}
+	fn(&iam.ListUserTagsOutput{Tags: f.userTags[aws.StringValue(in.UserName)]}, true)
+	return nil
+}
+
+func (f *fakeIAM) ListMFADevicesPagesWithContext(_ aws.Context, in *iam.ListMFADevicesInput, fn func(*iam.ListMFADevicesOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListMFADevices"); err != nil {
+		return err
+	}
+	fn(&iam.ListMFADevicesOutput{MFADevices: f.mfaDevices[aws.StringValue(in.UserName)]}, true)
+	return nil
+}
+
+func (f *fakeIAM) GetLoginProfileWithContext(_ aws.Context, in *iam.GetLoginProfileInput, _ ...request.Option) (*iam.GetLoginProfileOutput, error) {
+	if err := f.err("GetLoginProfile"); err != nil {
+		return nil, err
+	}
+	profile, ok := f.loginProfiles[aws.StringValue(in.UserName)]
+	if !ok {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "login profile not found", nil)
+	}
+	return &iam.GetLoginProfileOutput{LoginProfile: profile}, nil
+}
+
+func (f *fakeIAM) ListAccessKeysPagesWithContext(_ aws.Context, in *iam.ListAccessKeysInput, fn func(*iam.ListAccessKeysOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListAccessKeys"); err != nil {
+		return err
+	}
+	pages := f.accessKeys[aws.StringValue(in.UserName)]
+	for i, page := range pages {
+		if !fn(&iam.ListAccessKeysOutput{AccessKeyMetadata: page}, i == len(pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeIAM) GetAccessKeyLastUsedWithContext(_ aws.Context, in *iam.GetAccessKeyLastUsedInput, _ ...request.Option) (*iam.GetAccessKeyLastUsedOutput, error) {
+	if err := f.err("GetAccessKeyLastUsed"); err != nil {
+		return nil, err
+	}
+	lastUsed, ok := f.lastUsed[aws.StringValue(in.AccessKeyId)]
+	if !ok {
+		lastUsed = &iam.AccessKeyLastUsed{}
+	}
+	return &iam.GetAccessKeyLastUsedOutput{AccessKeyLastUsed: lastUsed}, nil
+}
+
+func (f *fakeIAM) ListPoliciesPagesWithContext(_ aws.Context, _ *iam.ListPoliciesInput, fn func(*iam.ListPoliciesOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListPolicies"); err != nil {
+		return err
+	}
+	for i, page := range f.policies {
+		if !fn(&iam.ListPoliciesOutput{Policies: page}, i == len(f.policies)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeIAM) GetPolicyVersionWithContext(_ aws.Context, in *iam.GetPolicyVersionInput, _ ...request.Option) (*iam.GetPolicyVersionOutput, error) {
+	if err := f.err("GetPolicyVersion"); err != nil {
+		return nil, err
+	}
+	return &iam.GetPolicyVersionOutput{PolicyVersion: f.policyVersions[aws.StringValue(in.PolicyArn)]}, nil
+}
+
+func (f *fakeIAM) ListUserPoliciesPagesWithContext(_ aws.Context, in *iam.ListUserPoliciesInput, fn func(*iam.ListUserPoliciesOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListUserPolicies"); err != nil {
+		return err
+	}
+	fn(&iam.ListUserPoliciesOutput{PolicyNames: f.inlinePolicies[aws.StringValue(in.UserName)]}, true)
+	return nil
+}
+
+func (f *fakeIAM) ListAttachedUserPoliciesPagesWithContext(_ aws.Context, in *iam.ListAttachedUserPoliciesInput, fn func(*iam.ListAttachedUserPoliciesOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListAttachedUserPolicies"); err != nil {
+		return err
+	}
+	fn(&iam.ListAttachedUserPoliciesOutput{AttachedPolicies: f.attached[aws.StringValue(in.UserName)]}, true)
+	return nil
+}
+
+func (f *fakeIAM) UpdateAccessKeyWithContext(_ aws.Context, in *iam.UpdateAccessKeyInput, _ ...request.Option) (*iam.UpdateAccessKeyOutput, error) {
+	if err := f.err("UpdateAccessKey"); err != nil {
+		return nil, err
+	}
+	f.record(in)
+	return &iam.UpdateAccessKeyOutput{}, nil
+}
+
+// fakeS3 is an s3iface.S3API of buckets and their configuration, keyed by
+// bucket name
+type fakeS3 struct {
+	s3iface.S3API
+	fakeErrors
+	fakeCalls
+
+	buckets []*s3.Bucket
+	// locations are the location constraints of the buckets, empty for
+	// us-east-1
+	locations  map[string]string
+	tags       map[string][]*s3.Tag
+	encryption map[string]*s3.ServerSideEncryptionConfiguration
+}
+
+// addBucket adds a bucket in us-east-1 without tags or default encryption
+func (f *fakeS3) addBucket(name string) {
+	f.buckets = append(f.buckets, &s3.Bucket{Name: aws.String(name)})
+}
+
+func (f *fakeS3) ListBucketsWithContext(aws.Context, *s3.ListBucketsInput, ...request.Option) (*s3.ListBucketsOutput, error) {
+	if err := f.err("ListBuckets"); err != nil {
+		return nil, err
+	}
+	return &s3.ListBucketsOutput{Buckets: f.buckets}, nil
+}
+
+func (f *fakeS3) GetBucketLocationWithContext(_ aws.Context, in *s3.GetBucketLocationInput, _ ...request.Option) (*s3.GetBucketLocationOutput, error) {
+	if err := f.err("GetBucketLocation"); err != nil {
+		return nil, err
+	}
+	out := &s3.GetBucketLocationOutput{}
+	if location := f.locations[aws.StringValue(in.Bucket)]; location != "" {
+		out.LocationConstraint = aws.String(location)
+	}
+	return out, nil
+}
+
+func (f *fakeS3) GetBucketTaggingWithContext(_ aws.Context, in *s3.GetBucketTaggingInput, _ ...request.Option) (*s3.GetBucketTaggingOutput, error) {
+	if err := f.err("GetBucketTagging"); err != nil {
+		return nil, err
+	}
+	tags, ok := f.tags[aws.StringValue(in.Bucket)]
+	if !ok {
+		return nil, awserr.New("NoSuchTagSet", "the tag set does not exist", nil)
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: tags}, nil
+}
+
+func (f *fakeS3) GetBucketEncryptionWithContext(_ aws.Context, in *s3.GetBucketEncryptionInput, _ ...request.Option) (*s3.GetBucketEncryptionOutput, error) {
+	if err := f.err("GetBucketEncryption"); err != nil {
+		return nil, err
+	}
+	encryption, ok := f.encryption[aws.StringValue(in.Bucket)]
+	if !ok {
+		return nil, awserr.New("ServerSideEncryptionConfigurationNotFoundError",
+			"the server side encryption configuration was not found", nil)
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: encryption}, nil
+}
+
+func (f *fakeS3) PutBucketEncryptionWithContext(_ aws.Context, in *s3.PutBucketEncryptionInput, _ ...request.Option) (*s3.PutBucketEncryptionOutput, error) {
+	if err := f.err("PutBucketEncryption"); err != nil {
+		return nil, err
+	}
+	f.record(in)
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+// fakeEC2 is an ec2iface.EC2API of VPCs, security groups and flow logs,
+// each listed one page at a time
+type fakeEC2 struct {
+	ec2iface.EC2API
+	fakeErrors
+	fakeCalls
+
+	vpcs           [][]*ec2.Vpc
+	securityGroups [][]*ec2.SecurityGroup
+	flowLogs       [][]*ec2.FlowLog
+}
+
+// addVPC adds a VPC owned by the test account
+func (f *fakeEC2) addVPC(id string) {
+	f.vpcs = append(f.vpcs, []*ec2.Vpc{{VpcId: aws.String(id), OwnerId: aws.String(testAccountID)}})
+}
+
+// addSecurityGroup adds a security group of vpc with the given inbound
+// permissions
+func (f *fakeEC2) addSecurityGroup(vpc, id, name string, perms ...*ec2.IpPermission) {
+	f.securityGroups = append(f.securityGroups, []*ec2.SecurityGroup{{
+		GroupId:       aws.String(id),
+		GroupName:     aws.String(name),
+		VpcId:         aws.String(vpc),
+		OwnerId:       aws.String(testAccountID),
+		IpPermissions: perms,
+	}})
+}
+
+// addFlowLog adds a flow log of vpc
+func (f *fakeEC2) addFlowLog(vpc string) {
+	f.flowLogs = append(f.flowLogs, []*ec2.FlowLog{{
+		FlowLogId:  aws.String("fl-" + vpc),
+		ResourceId: aws.String(vpc),
+	}})
+}
+
+func (f *fakeEC2) DescribeVpcsPagesWithContext(_ aws.Context, _ *ec2.DescribeVpcsInput, fn func(*ec2.DescribeVpcsOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("DescribeVpcs"); err != nil {
+		return err
+	}
+	for i, page := range f.vpcs {
+		if !fn(&ec2.DescribeVpcsOutput{Vpcs: page}, i == len(f.vpcs)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) DescribeSecurityGroupsPagesWithContext(_ aws.Context, _ *ec2.DescribeSecurityGroupsInput, fn func(*ec2.DescribeSecurityGroupsOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("DescribeSecurityGroups"); err != nil {
+		return err
+	}
+	for i, page := range f.securityGroups {
+		if !fn(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: page}, i == len(f.securityGroups)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) DescribeFlowLogsPagesWithContext(_ aws.Context, _ *ec2.DescribeFlowLogsInput, fn func(*ec2.DescribeFlowLogsOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("DescribeFlowLogs"); err != nil {
+		return err
+	}
+	for i, page := range f.flowLogs {
+		if !fn(&ec2.DescribeFlowLogsOutput{FlowLogs: page}, i == len(f.flowLogs)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) CreateFlowLogsWithContext(_ aws.Context, in *ec2.CreateFlowLogsInput, _ ...request.Option) (*ec2.CreateFlowLogsOutput, error) {
+	if err := f.err("CreateFlowLogs"); err != nil {
+		return nil, err
+	}
+	f.record(in)
+	return &ec2.CreateFlowLogsOutput{}, nil
+}
+
+func (f *fakeEC2) AuthorizeSecurityGroupIngressWithContext(_ aws.Context, in *ec2.AuthorizeSecurityGroupIngressInput, _ ...request.Option) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	if err := f.err("AuthorizeSecurityGroupIngress"); err != nil {
+		return nil, err
+	}
+	f.record(in)
+	return &ec2.AuthorizeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+}
+
+func (f *fakeEC2) RevokeSecurityGroupIngressWithContext(_ aws.Context, in *ec2.RevokeSecurityGroupIngressInput, _ ...request.Option) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	if err := f.err("RevokeSecurityGroupIngress"); err != nil {
+		return nil, err
+	}
+	f.record(in)
+	return &ec2.RevokeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+}
+
+// fakeCloudTrail is a cloudtrailiface.CloudTrailAPI of trails, listed in
+// every region, and their event selectors and tags, keyed by trail ARN
+type fakeCloudTrail struct {
+	cloudtrailiface.CloudTrailAPI
+	fakeErrors
+	fakeCalls
+
+	trails    []*cloudtrail.Trail
+	selectors map[string][]*cloudtrail.EventSelector
+	tags      map[string][]*cloudtrail.Tag
+}
+
+// addTrail adds a trail of the test account in us-east-1 that is neither
+// encrypted nor validated
+func (f *fakeCloudTrail) addTrail(name string, multiRegion bool) *cloudtrail.Trail {
+	trail := &cloudtrail.Trail{
+		Name:               aws.String(name),
+		TrailARN:           aws.String("arn:aws:cloudtrail:" + testRegion + ":" + testAccountID + ":trail/" + name),
+		HomeRegion:         aws.String(testRegion),
+		S3BucketName:       aws.String("trail-logs"),
+		IsMultiRegionTrail: aws.Bool(multiRegion),
+	}
+	f.trails = append(f.trails, trail)
+	return trail
+}
+
+func (f *fakeCloudTrail) DescribeTrailsWithContext(aws.Context, *cloudtrail.DescribeTrailsInput, ...request.Option) (*cloudtrail.DescribeTrailsOutput, error) {
+	if err := f.err("DescribeTrails"); err != nil {
+		return nil, err
+	}
+	return &cloudtrail.DescribeTrailsOutput{TrailList: f.trails}, nil
+}
+
+func (f *fakeCloudTrail) ListTagsPagesWithContext(_ aws.Context, in *cloudtrail.ListTagsInput, fn func(*cloudtrail.ListTagsOutput, bool) bool, _ ...request.Option) error {
+	if err := f.err("ListTags"); err != nil {
+		return err
+	}
+	out := &cloudtrail.ListTagsOutput{}
+	for _, id := range in.ResourceIdList {
+		out.ResourceTagList = append(out.ResourceTagList, &cloudtrail.ResourceTag{
+			ResourceId: id,
+			TagsList:   f.tags[aws.StringValue(id)],
+		})
+	}
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeCloudTrail) GetEventSelectorsWithContext(_ aws.Context, in *cloudtrail.GetEventSelectorsInput, _ ...request.Option) (*cloudtrail.GetEventSelectorsOutput, error) {
+	if err := f.err("GetEventSelectors"); err != nil {
+		return nil, err
+	}
+	return &cloudtrail.GetEventSelectorsOutput{EventSelectors: f.selectors[aws.StringValue(in.TrailName)]}, nil
+}
+
+func (f *fakeCloudTrail) UpdateTrailWithContext(_ aws.Context, in *cloudtrail.UpdateTrailInput, _ ...request.Option) (*cloudtrail.UpdateTrailOutput, error) {
+	if err := f.err("UpdateTrail"); err != nil {
+		return nil, err
+	}
+	f.record(in)
+	return &cloudtrail.UpdateTrailOutput{}, nil
+}
+
+// fakeSTS is an stsiface.STSAPI whose caller is in the test account
+type fakeSTS struct {
+	stsiface.STSAPI
+	fakeErrors
+}
+
+func (f *fakeSTS) GetCallerIdentityWithContext(aws.Context, *sts.GetCallerIdentityInput, ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	if err := f.err("GetCallerIdentity"); err != nil {
+		return nil, err
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(testAccountID),
+		Arn:     aws.String("arn:aws:iam::" + testAccountID + ":user/auditor"),
+	}, nil
+}
+
+// newFakeAWS returns an AWS integration checking the rules matching rules in
+// the us-east-1 region of the account of clients
+func newFakeAWS(ctx context.Context, clients *fakeClients, rules ...string) (*AWS, error) {
+	return NewAWSWithClients(ctx, clients, Options{
+		Region:  testRegion,
+		Regions: []string{testRegion},
+		Filter:  RuleFilter{Rules: rules},
+	})
+}
@@ -0,0 +1,153 @@
+package integration
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Inventory is the AWS configuration of one account that rules are evaluated
+// against. It holds the responses of the AWS APIs as returned by the SDK.
+//
+// Every part of the inventory that could not be collected has its error
+// message set instead, so that only the rules needing that part fail. Parts
+// of services that were not collected are empty.
+type Inventory struct {
+	AccountID string `json:"account_id"`
+	// Error is set if the account could not be accessed, in which case
+	// nothing else is collected
+	Error string `json:"error,omitempty"`
+	// Partition is the account's partition, e.g. aws or aws-cn
+	Partition string `json:"partition"`
+	// CollectedAt is when collection started. Rules that depend on the
+	// current time use it instead, so an inventory always evaluates the same.
+	CollectedAt time.Time `json:"collected_at"`
+	// Services lists the services that were collected
+	Services   []string            `json:"services"`
+	IAM        IAMInventory        `json:"iam"`
+	S3         S3Inventory         `json:"s3"`
+	Regions    []RegionInventory   `json:"regions"`
+	CloudTrail CloudTrailInventory `json:"cloudtrail"`
+}
+
+// IAMInventory is the IAM configuration of an account
+type IAMInventory struct {
+	// AccountSummary is the result of GetAccountSummary
+	AccountSummary      map[string]*int64 `json:"account_summary"`
+	AccountSummaryError string            `json:"account_summary_error,omitempty"`
+	Users               []IAMUser         `json:"users"`
+	UsersError          string            `json:"users_error,omitempty"`
+	// Policies are the customer managed policies
+	Policies      []IAMPolicy `json:"policies"`
+	PoliciesError string      `json:"policies_error,omitempty"`
+}
+
+// IAMUser is an IAM user, including its tags, and its credentials and
+// policies
+type IAMUser struct {
+	User       *iam.User        `json:"user"`
+	TagsError  string           `json:"tags_error,omitempty"`
+	MFADevices []*iam.MFADevice `json:"mfa_devices"`
+	MFAError   string           `json:"mfa_error,omitempty"`
+	// LoginProfile is nil if the user has no console access
+	LoginProfile      *iam.LoginProfile `json:"login_profile"`
+	LoginProfileError string            `json:"login_profile_error,omitempty"`
+	AccessKeys        []IAMAccessKey    `json:"access_keys"`
+	AccessKeysError   string            `json:"access_keys_error,omitempty"`
+	// InlinePolicyNames are the names of the user's inline policies
+	InlinePolicyNames     []*string             `json:"inline_policy_names"`
+	InlinePoliciesError   string                `json:"inline_policies_error,omitempty"`
+	AttachedPolicies      []*iam.AttachedPolicy `json:"attached_policies"`
+	AttachedPoliciesError string                `json:"attached_policies_error,omitempty"`
+}
+
+// IAMAccessKey is an access key and when it was last used
+type IAMAccessKey struct {
+	Key           *iam.AccessKeyMetadata `json:"key"`
+	LastUsed      *iam.AccessKeyLastUsed `json:"last_used"`
+	LastUsedError string                 `json:"last_used_error,omitempty"`
+}
+
+// IAMPolicy is a managed policy and its default version
+type IAMPolicy struct {
+	Policy              *iam.Policy        `json:"policy"`
+	DefaultVersion      *iam.PolicyVersion `json:"default_version"`
+	DefaultVersionError string             `json:"default_version_error,omitempty"`
+}
+
+// S3Inventory is the S3 configuration of an account
+type S3Inventory struct {
+	Buckets      []S3Bucket `json:"buckets"`
+	BucketsError string     `json:"buckets_error,omitempty"`
+}
+
+// S3Bucket is a bucket and its configuration
+type S3Bucket struct {
+	Bucket *s3.Bucket `json:"bucket"`
+	// Region is the bucket's region. It is empty if LocationError is set, in
+	// which case nothing else is collected.
+	Region        string            `json:"region"`
+	LocationError string            `json:"location_error,omitempty"`
+	Tags          map[string]string `json:"tags"`
+	TagsError     string            `json:"tags_error,omitempty"`
+	// Encryption is nil if the bucket has no default encryption
+	Encryption      *s3.ServerSideEncryptionConfiguration `json:"encryption"`
+	EncryptionError string                                `json:"encryption_error,omitempty"`
+}
+
+// RegionInventory is the configuration of an account's regional resources in
+// one region
+type RegionInventory struct {
+	Region              string               `json:"region"`
+	VPCs                []*ec2.Vpc           `json:"vpcs"`
+	VPCsError           string               `json:"vpcs_error,omitempty"`
+	SecurityGroups      []*ec2.SecurityGroup `json:"security_groups"`
+	SecurityGroupsError string               `json:"security_groups_error,omitempty"`
+	FlowLogs            []*ec2.FlowLog       `json:"flow_logs"`
+	FlowLogsError       string               `json:"flow_logs_error,omitempty"`
+	// TrailsError is set if the trails of the region could not be listed.
+	// The trails themselves are in CloudTrailInventory.
+	TrailsError string `json:"trails_error,omitempty"`
+}
+
+// CloudTrailInventory is the CloudTrail configuration of an account
+type CloudTrailInventory struct {
+	// Trails are the trails of every region, each listed once
+	Trails []CloudTrailTrail `json:"trails"`
+}
+
+// CloudTrailTrail is a trail, its tags and its event selectors
+type CloudTrailTrail struct {
+	Trail     *cloudtrail.Trail `json:"trail"`
+	Tags      map[string]string `json:"tags"`
+	TagsError string            `json:"tags_error,omitempty"`
+	// EventSelectors are only collected for multi-region trails
+	EventSelectors      []*cloudtrail.EventSelector `json:"event_selectors"`
+	EventSelectorsError string                      `json:"event_selectors_error,omitempty"`
+}
+
+// account returns the account inv was collected from
+func (inv *Inventory) account() awsAccount {
+	return awsAccount{ID: inv.AccountID, Partition: inv.Partition}
+}
+
+// collectErr returns an error of message, or nil if message is empty.
+// Inventories hold error messages rather than errors so they can be saved.
+func collectErr(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
+
+// errString returns err's message, or "" if err is nil
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
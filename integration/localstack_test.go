@@ -0,0 +1,130 @@
+//go:build localstack
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// localstackEndpoint returns the LocalStack endpoint given by
+// LOCALSTACK_ENDPOINT, or the default one
+func localstackEndpoint() string {
+	if endpoint := os.Getenv("LOCALSTACK_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return "http://localhost:4566"
+}
+
+// TestLocalStack creates non-compliant resources in LocalStack and checks
+// that a scan reports them. Run it with go test -tags localstack against a
+// running LocalStack.
+func TestLocalStack(t *testing.T) {
+	endpoint := localstackEndpoint()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", os.DevNull)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+
+	s, err := session.NewSession(aws.NewConfig().
+		WithRegion(testRegion).
+		WithEndpoint(endpoint).
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("test", "test", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	s3API, ec2API := s3.New(s), ec2.New(s)
+
+	// New buckets have default encryption, so it is removed.
+	bucket := fmt.Sprintf("plio-unencrypted-%d", time.Now().UnixNano())
+	if _, err := s3API.CreateBucketWithContext(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatalf("creating bucket: %v", err)
+	}
+	t.Cleanup(func() {
+		s3API.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	})
+	if _, err := s3API.DeleteBucketEncryptionWithContext(ctx, &s3.DeleteBucketEncryptionInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatalf("removing bucket encryption: %v", err)
+	}
+
+	vpc, err := ec2API.CreateVpcWithContext(ctx, &ec2.CreateVpcInput{CidrBlock: aws.String("10.42.0.0/16")})
+	if err != nil {
+		t.Fatalf("creating VPC: %v", err)
+	}
+	vpcID := aws.StringValue(vpc.Vpc.VpcId)
+	t.Cleanup(func() {
+		ec2API.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)})
+	})
+
+	sg, err := ec2API.CreateSecurityGroupWithContext(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(fmt.Sprintf("plio-open-ssh-%d", time.Now().UnixNano())),
+		Description: aws.String("SSH from anywhere"),
+		VpcId:       aws.String(vpcID),
+	})
+	if err != nil {
+		t.Fatalf("creating security group: %v", err)
+	}
+	sgID := aws.StringValue(sg.GroupId)
+	// Registered after the VPC's cleanup, so it runs before it.
+	t.Cleanup(func() {
+		ec2API.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(sgID)})
+	})
+	if _, err := ec2API.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(sgID),
+		IpPermissions: []*ec2.IpPermission{sshFrom("0.0.0.0/0")},
+	}); err != nil {
+		t.Fatalf("allowing SSH: %v", err)
+	}
+
+	a, err := NewAWS(ctx, Options{
+		Region:    testRegion,
+		Regions:   []string{testRegion},
+		Endpoints: Endpoints{URL: endpoint},
+		Filter:    RuleFilter{Rules: []string{"AWS-S3-001", "AWS-VPC-001", "AWS-VPC-003"}},
+	})
+	if err != nil {
+		t.Fatalf("NewAWS() error = %v", err)
+	}
+	res, err := a.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	findings := map[string]map[string]Result{}
+	for _, r := range res {
+		if findings[r.RuleID] == nil {
+			findings[r.RuleID] = map[string]Result{}
+		}
+		findings[r.RuleID][r.Resource.Name] = r
+	}
+	for _, want := range []struct {
+		rule, resourceType, resource string
+	}{
+		{"AWS-S3-001", "aws/s3-bucket", bucket},
+		{"AWS-VPC-001", "aws/vpc", vpcID},
+		{"AWS-VPC-003", "aws/security-group", sgID},
+	} {
+		r, ok := findings[want.rule][want.resource]
+		switch {
+		case !ok:
+			t.Errorf("no %s result of %s", want.rule, want.resource)
+		case r.Status != StatusNonCompliant:
+			t.Errorf("%s result of %s is %s (%s), want %s", want.rule, want.resource, r.Status, r.Reason, StatusNonCompliant)
+		case r.Resource.Type != want.resourceType || r.Resource.Region != testRegion:
+			t.Errorf("%s resource = %+v, want a %s in %s", want.rule, r.Resource, want.resourceType, testRegion)
+		}
+	}
+}
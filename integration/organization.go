@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+)
+
+// DefaultOrganizationRole is the role AWS Organizations creates in accounts
+// it creates, which the management account can assume
+const DefaultOrganizationRole = "OrganizationAccountAccessRole"
+
+// OrganizationOptions configures how the member accounts of an AWS
+// Organization are accessed
+type OrganizationOptions struct {
+	// RoleName is the name of the audit role assumed in every member
+	// account. The caller's own account is checked with the caller's
+	// credentials.
+	RoleName string `yaml:"role_name"`
+	// ExternalID, if set, is passed when assuming RoleName
+	ExternalID string `yaml:"external_id"`
+}
+
+// organization is the set of member accounts checked by an AWS integration
+type organization struct {
+	members []member
+}
+
+// member is a member account of an organization
+type member struct {
+	ID   string
+	Name string
+	// aws checks the account. It is nil if the account could not be
+	// accessed, in which case err is set.
+	aws *AWS
+	err error
+}
+
+// newOrganizationAWS returns an AWS integration that checks every active
+// member account of the organization of the account whose credentials
+// clients use. Only the accounts in opts.Accounts are checked, if set.
+func newOrganizationAWS(ctx context.Context, clients Clients, opts Options, rules []Rule, pool *workerPool) (*AWS, error) {
+	caller, err := callerAccount(ctx, clients, opts.Region)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := listAccounts(ctx, clients.Organizations(opts.Region))
+	if err != nil {
+		return nil, fmt.Errorf("listing organization accounts: %w", err)
+	}
+
+	var selected []*organizations.Account
+	for _, account := range accounts {
+		if aws.StringValue(account.Status) != organizations.AccountStatusActive {
+			continue
+		}
+		if len(opts.Accounts) > 0 && !contains(opts.Accounts, aws.StringValue(account.Id)) {
+			continue
+		}
+		selected = append(selected, account)
+	}
+
+	roleName := opts.Organization.RoleName
+	if roleName == "" {
+		roleName = DefaultOrganizationRole
+	}
+	// An account that cannot be accessed is reported in the results rather
+	// than failing the scan of every other account. Setting up an account
+	// makes API calls, but does not itself use the pool, so it runs on it.
+	members, err := run(ctx, pool, len(selected), func(ctx context.Context, i int) ([]member, error) {
+		m := member{
+			ID:   aws.StringValue(selected[i].Id),
+			Name: aws.StringValue(selected[i].Name),
+		}
+		memberClients := clients
+		if m.ID != caller.ID {
+			roleARN := arn.ARN{
+				Partition: caller.partition(),
+				Service:   "iam",
+				AccountID: m.ID,
+				Resource:  "role/" + roleName,
+			}.String()
+			memberClients = clients.AssumeRole(roleARN, opts.Organization.ExternalID)
+		}
+
+		m.aws, m.err = newAccountAWS(ctx, memberClients, opts, rules, pool)
+		if m.err == nil && m.aws.account.ID != m.ID {
+			m.aws, m.err = nil, fmt.Errorf("assumed role is in account %s, not %s", m.aws.account.ID, m.ID)
+		}
+		if m.err != nil {
+			m.err = fmt.Errorf("accessing account %s (%s): %w", m.ID, m.Name, m.err)
+		}
+		return []member{m}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AWS{
+		account: caller,
+		org:     &organization{members: members},
+		rules:   rules,
+		params:  opts.Params,
+		tags:    opts.Tags,
+		waivers: opts.Waivers,
+	}, nil
+}
+
+// collect concurrently collects the inventory of every member account of o.
+// Accounts are not run on the pool their collectors share, since they would
+// hold a worker while waiting for their own calls. The inventory of an account
+// that could not be accessed only has its error set.
+func (o *organization) collect(ctx context.Context) ([]*Inventory, error) {
+	return gather(ctx, len(o.members), func(ctx context.Context, i int) ([]*Inventory, error) {
+		m := o.members[i]
+		if m.err != nil {
+			return []*Inventory{{AccountID: m.ID, Error: m.err.Error()}}, nil
+		}
+		inv, err := m.aws.collector.collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []*Inventory{inv}, nil
+	})
+}
+
+// listAccounts returns every account of the organization
+func listAccounts(ctx context.Context, orgAPI organizationsiface.OrganizationsAPI) ([]*organizations.Account, error) {
+	var accounts []*organizations.Account
+	err := orgAPI.ListAccountsPagesWithContext(ctx, &organizations.ListAccountsInput{},
+		func(page *organizations.ListAccountsOutput, _ bool) bool {
+			accounts = append(accounts, page.Accounts...)
+			return true
+		})
+	return accounts, err
+}
+
+func accountResource(accountID string) Resource {
+	return Resource{
+		Type:      "aws/account",
+		Name:      accountID,
+		AccountID: accountID,
+	}
+}
@@ -0,0 +1,101 @@
+package integration
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestCheckPolicyNoStatementsWithAdminAccessDocumentShapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     Status
+	}{
+		{
+			name:     "statement list",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			want:     StatusNonCompliant,
+		},
+		{
+			name:     "single statement",
+			document: `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"*","Resource":"*"}}`,
+			want:     StatusNonCompliant,
+		},
+		{
+			name:     "action and resource lists",
+			document: `{"Statement":[{"Effect":"Allow","Action":["s3:GetObject","*"],"Resource":["*"]}]}`,
+			want:     StatusNonCompliant,
+		},
+		{
+			name:     "scoped single statement",
+			document: `{"Statement":{"Effect":"Allow","Action":["s3:GetObject"],"Resource":"arn:aws:s3:::bucket/*"}}`,
+			want:     StatusCompliant,
+		},
+		{
+			name:     "deny all",
+			document: `{"Statement":{"Effect":"Deny","Action":"*","Resource":"*"}}`,
+			want:     StatusCompliant,
+		},
+		{
+			name:     "not action",
+			document: `{"Statement":{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}}`,
+			want:     StatusCompliant,
+		},
+		{
+			name:     "statement is a string",
+			document: `{"Statement":"*"}`,
+			want:     StatusError,
+		},
+		{
+			name:     "statement list of strings",
+			document: `{"Statement":["*"]}`,
+			want:     StatusError,
+		},
+		{
+			name:     "effect is not a string",
+			document: `{"Statement":{"Effect":true,"Action":"*","Resource":"*"}}`,
+			want:     StatusError,
+		},
+		{
+			name:     "action is a number",
+			document: `{"Statement":{"Effect":"Allow","Action":1,"Resource":"*"}}`,
+			want:     StatusError,
+		},
+		{
+			name:     "resource list of numbers",
+			document: `{"Statement":{"Effect":"Allow","Action":"*","Resource":[1]}}`,
+			want:     StatusError,
+		},
+		{
+			name:     "not JSON",
+			document: `{`,
+			want:     StatusError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &Inventory{AccountID: "111122223333"}
+			inv.IAM.Policies = []IAMPolicy{{
+				Policy: &iam.Policy{
+					PolicyName: aws.String("policy"),
+					Arn:        aws.String("arn:aws:iam::111122223333:policy/policy"),
+				},
+				DefaultVersion: &iam.PolicyVersion{Document: aws.String(url.QueryEscape(tt.document))},
+			}}
+
+			res, err := checkPolicyNoStatementsWithAdminAccess(inv, nil)
+			if err != nil {
+				t.Fatalf("checkPolicyNoStatementsWithAdminAccess() error = %v", err)
+			}
+			if len(res) != 1 {
+				t.Fatalf("checkPolicyNoStatementsWithAdminAccess() returned %d results, want 1", len(res))
+			}
+			if res[0].Status != tt.want {
+				t.Errorf("status = %s (%s), want %s", res[0].Status, res[0].Reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package integration
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool bounds the number of concurrent workers making AWS API calls.
+// A nil *workerPool runs work sequentially.
+type workerPool struct {
+	sem chan struct{}
+}
+
+// newWorkerPool returns a pool running at most size workers at a time
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{sem: make(chan struct{}, size)}
+}
+
+// run calls fn for every index in [0, n) on pool p and returns the results in
+// index order
+func run[T any](ctx context.Context, p *workerPool, n int, fn func(context.Context, int) ([]T, error)) ([]T, error) {
+	if p == nil {
+		var res []T
+		for i := 0; i < n; i++ {
+			iRes, err := fn(ctx, i)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, iRes...)
+		}
+		return res, nil
+	}
+
+	return gather(ctx, n, func(ctx context.Context, i int) ([]T, error) {
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() { <-p.sem }()
+
+		return fn(ctx, i)
+	})
+}
+
+// gather calls fn concurrently for every index in [0, n) and returns the
+// results in index order. The first error cancels the context passed to the
+// remaining calls and is returned.
+func gather[T any](ctx context.Context, n int, fn func(context.Context, int) ([]T, error)) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	results := make([][]T, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			res, err := fn(ctx, i)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return concatSlice(results...), nil
+}
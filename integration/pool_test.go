@@ -0,0 +1,118 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLimit(t *testing.T) {
+	const size = 3
+	var active, maxActive int32
+	_, err := run(context.Background(), newWorkerPool(size), 20, func(context.Context, int) ([]struct{}, error) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if maxActive > size {
+		t.Errorf("run() ran %d workers at a time, want at most %d", maxActive, size)
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	const n = 10
+	var want []int
+	for i := 0; i < n; i++ {
+		want = append(want, i, i)
+	}
+
+	for _, tt := range []struct {
+		name string
+		pool *workerPool
+	}{
+		{name: "sequential"},
+		{name: "one worker", pool: newWorkerPool(1)},
+		{name: "many workers", pool: newWorkerPool(n)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(context.Background(), tt.pool, n, func(_ context.Context, i int) ([]int, error) {
+				// Later indexes finish first.
+				time.Sleep(time.Duration(n-i) * time.Millisecond)
+				return []int{i, i}, nil
+			})
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("run() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRunFirstError(t *testing.T) {
+	const n = 5
+	errFailed := errors.New("failed")
+	res, err := run(context.Background(), newWorkerPool(n), n, func(ctx context.Context, i int) ([]int, error) {
+		if i == 2 {
+			return nil, errFailed
+		}
+		// The other calls only return once the error cancels them.
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, errFailed) || res != nil {
+		t.Errorf("run() = %v, %v, want %v", res, err, errFailed)
+	}
+
+	var calls int32
+	_, err = run(context.Background(), nil, n, func(_ context.Context, i int) ([]int, error) {
+		atomic.AddInt32(&calls, 1)
+		if i == 2 {
+			return nil, errFailed
+		}
+		return []int{i}, nil
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("sequential run() error = %v, want %v", err, errFailed)
+	}
+	if calls != 3 {
+		t.Errorf("sequential run() made %d calls after failing, want 3", calls)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 1)
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	// The pool's only worker is held until ctx is canceled, so every other
+	// call is left waiting for it.
+	_, err := run(ctx, newWorkerPool(1), 10, func(ctx context.Context, i int) ([]int, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("run() error = %v, want %v", err, context.Canceled)
+	}
+}
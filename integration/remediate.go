@@ -0,0 +1,299 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// RemediateOptions configures the fixes of a remediation plan
+type RemediateOptions struct {
+	// FlowLogDestination is the ARN of the S3 bucket, optionally followed by
+	// a prefix, that created VPC flow logs are delivered to. It is required
+	// to fix AWS-VPC-001.
+	FlowLogDestination string
+}
+
+// Validate checks that o can fix the findings of rules
+func (o RemediateOptions) Validate(rules []Rule) error {
+	for _, r := range rules {
+		if r.ID != "AWS-VPC-001" {
+			continue
+		}
+		if o.FlowLogDestination == "" {
+			return errors.New("fixing AWS-VPC-001 requires a flow log destination")
+		}
+		dest, err := arn.Parse(o.FlowLogDestination)
+		if err != nil || dest.Service != "s3" {
+			return fmt.Errorf("flow log destination %q is not the ARN of an S3 bucket", o.FlowLogDestination)
+		}
+	}
+	return nil
+}
+
+// ActionStatus is the state of a remediation action
+type ActionStatus string
+
+// Statuses an Action can have
+const (
+	ActionPlanned ActionStatus = "planned"
+	ActionApplied ActionStatus = "applied"
+	ActionFailed  ActionStatus = "failed"
+)
+
+// Action is a change fixing a non-compliant resource
+type Action struct {
+	RuleID   string   `json:"rule_id"`
+	Resource Resource `json:"resource"`
+	// Description describes the change
+	Description string       `json:"description"`
+	Status      ActionStatus `json:"status"`
+	// Error is why the change failed, if its status is ActionFailed
+	Error string `json:"error,omitempty"`
+
+	fix *fix
+	env fixEnv
+}
+
+// Apply makes the change of act and sets its status accordingly
+func (act *Action) Apply(ctx context.Context) error {
+	if err := act.fix.apply(ctx, act.env); err != nil {
+		act.Status, act.Error = ActionFailed, err.Error()
+		return err
+	}
+	act.Status = ActionApplied
+	return nil
+}
+
+// Plan is the changes fixing the findings of a scan
+type Plan struct {
+	Actions []Action `json:"actions"`
+	// Errors are the resources that could not be checked, which may need
+	// fixes that are not planned
+	Errors []CheckError `json:"errors"`
+}
+
+// fix is a change fixing a finding, as made by an Action
+type fix struct {
+	description string
+	apply       func(ctx context.Context, env fixEnv) error
+}
+
+// fixEnv is what a fix needs to change the account of its finding
+type fixEnv struct {
+	clients Clients
+	// region is the region used for global API calls
+	region string
+	opts   RemediateOptions
+}
+
+// withFix sets the fix of res and returns res
+func (res Result) withFix(f *fix) Result {
+	res.fix = f
+	return res
+}
+
+// Plan checks the remediable rules selected by Options.Filter and returns
+// the changes fixing their non-compliant, unwaived findings on the resources
+// selected by Options.Tags. Nothing is changed until the actions are applied.
+func (a *AWS) Plan(ctx context.Context, opts RemediateOptions) (*Plan, error) {
+	var rules []Rule
+	for _, r := range a.rules {
+		if r.Remediable {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("none of the selected rules can be remediated")
+	}
+	if err := opts.Validate(rules); err != nil {
+		return nil, err
+	}
+
+	members := []member{{ID: a.account.ID, aws: a}}
+	if a.org != nil {
+		members = a.org.members
+	}
+	// Every action changes the account it was found in, with that account's
+	// clients.
+	type finding struct {
+		res Result
+		env fixEnv
+	}
+	findings, err := gather(ctx, len(members), func(ctx context.Context, i int) ([]finding, error) {
+		m := members[i]
+		var res []Result
+		env := fixEnv{opts: opts}
+		if m.err != nil {
+			res = errorResults(rules, accountResource(m.ID), m.err)
+		} else {
+			inv, err := m.aws.collector.collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+			res = evaluateRules(inv, rules, a.params)
+			env.clients, env.region = m.aws.collector.clients, m.aws.collector.region
+		}
+
+		var findings []finding
+		for _, r := range applyWaivers(filterByTags(res, a.tags), a.waivers, time.Now()) {
+			findings = append(findings, finding{res: r, env: env})
+		}
+		return findings, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Actions: []Action{}, Errors: []CheckError{}}
+	for _, f := range findings {
+		switch {
+		case f.res.Status == StatusError:
+			plan.Errors = append(plan.Errors, CheckError{
+				RuleID:   f.res.RuleID,
+				Resource: f.res.Resource,
+				Error:    f.res.Reason,
+			})
+		case f.res.Status == StatusNonCompliant && f.res.fix != nil:
+			plan.Actions = append(plan.Actions, Action{
+				RuleID:      f.res.RuleID,
+				Resource:    f.res.Resource,
+				Description: f.res.fix.description,
+				Status:      ActionPlanned,
+				fix:         f.res.fix,
+				env:         f.env,
+			})
+		}
+	}
+	return plan, nil
+}
+
+// accessKeyFix deactivates an unused access key of user
+func accessKeyFix(user IAMUser, key IAMAccessKey) *fix {
+	return &fix{
+		description: fmt.Sprintf("Deactivate access key %s of user %s",
+			aws.StringValue(key.Key.AccessKeyId), aws.StringValue(user.User.UserName)),
+		apply: func(ctx context.Context, env fixEnv) error {
+			_, err := env.clients.IAM(env.region).UpdateAccessKeyWithContext(ctx, &iam.UpdateAccessKeyInput{
+				UserName:    user.User.UserName,
+				AccessKeyId: key.Key.AccessKeyId,
+				Status:      aws.String(iam.StatusTypeInactive),
+			})
+			return err
+		},
+	}
+}
+
+// bucketEncryptionFix enables default SSE-S3 encryption on bucket
+func bucketEncryptionFix(bucket S3Bucket) *fix {
+	return &fix{
+		description: fmt.Sprintf("Enable default SSE-S3 encryption on bucket %s", aws.StringValue(bucket.Bucket.Name)),
+		apply: func(ctx context.Context, env fixEnv) error {
+			_, err := env.clients.S3(bucket.Region).PutBucketEncryptionWithContext(ctx, &s3.PutBucketEncryptionInput{
+				Bucket: bucket.Bucket.Name,
+				ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+					Rules: []*s3.ServerSideEncryptionRule{{
+						ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+							SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+						},
+					}},
+				},
+			})
+			return err
+		},
+	}
+}
+
+// flowLogsFix creates a flow log of the rejected traffic of vpc, delivered
+// to the flow log destination
+func flowLogsFix(region RegionInventory, vpc *ec2.Vpc) *fix {
+	return &fix{
+		description: fmt.Sprintf("Create a flow log of the rejected traffic of VPC %s", aws.StringValue(vpc.VpcId)),
+		apply: func(ctx context.Context, env fixEnv) error {
+			out, err := env.clients.EC2(region.Region).CreateFlowLogsWithContext(ctx, &ec2.CreateFlowLogsInput{
+				ResourceType:       aws.String(ec2.FlowLogsResourceTypeVpc),
+				ResourceIds:        []*string{vpc.VpcId},
+				TrafficType:        aws.String(ec2.TrafficTypeReject),
+				LogDestinationType: aws.String(ec2.LogDestinationTypeS3),
+				LogDestination:     aws.String(env.opts.FlowLogDestination),
+			})
+			if err != nil {
+				return err
+			}
+			for _, item := range out.Unsuccessful {
+				if item.Error != nil {
+					return fmt.Errorf("%s: %s", aws.StringValue(item.Error.Code), aws.StringValue(item.Error.Message))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// sshFix revokes the inbound rules of sg allowing SSH from anywhere. The
+// other ports of rules with wider port ranges are allowed again by new
+// rules, which are added first so those ports stay reachable.
+func sshFix(region RegionInventory, sg *ec2.SecurityGroup) *fix {
+	open := openSSHPermissions(sg)
+	rest := permissionsWithoutSSH(open)
+	description := fmt.Sprintf("Revoke the inbound rules of security group %s allowing SSH from anywhere (%s)",
+		aws.StringValue(sg.GroupId), describePermissions(open))
+	if len(rest) > 0 {
+		description += fmt.Sprintf(", allowing their other ports again (%s)", describePermissions(rest))
+	}
+	return &fix{
+		description: description,
+		apply: func(ctx context.Context, env fixEnv) error {
+			ec2API := env.clients.EC2(region.Region)
+			// Every rule is added on its own, so that rules that already
+			// exist do not prevent adding the others.
+			for _, rule := range singleRulePermissions(rest) {
+				_, err := ec2API.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+					GroupId:       sg.GroupId,
+					IpPermissions: []*ec2.IpPermission{rule},
+				})
+				if err != nil && !isErrorCode(err, "InvalidPermission.Duplicate") {
+					return err
+				}
+			}
+
+			out, err := ec2API.RevokeSecurityGroupIngressWithContext(ctx, &ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: open,
+			})
+			if err != nil {
+				return err
+			}
+			// Revoking rules that no longer exist succeeds without
+			// changing anything.
+			if len(out.UnknownIpPermissions) > 0 {
+				return errors.New("some inbound rules no longer exist")
+			}
+			return nil
+		},
+	}
+}
+
+// logValidationFix enables log file validation on trail
+func logValidationFix(trail CloudTrailTrail) *fix {
+	return &fix{
+		description: fmt.Sprintf("Enable log file validation on trail %s", aws.StringValue(trail.Trail.Name)),
+		apply: func(ctx context.Context, env fixEnv) error {
+			// Trails can only be updated in their home region.
+			_, err := env.clients.CloudTrail(aws.StringValue(trail.Trail.HomeRegion)).UpdateTrailWithContext(ctx,
+				&cloudtrail.UpdateTrailInput{
+					Name:                    trail.Trail.TrailARN,
+					EnableLogFileValidation: aws.Bool(true),
+				})
+			return err
+		},
+	}
+}
@@ -0,0 +1,286 @@
+package integration
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// recordedRules describes the permissions of the recorded calls authorizing
+// or revoking inbound rules, in call order
+func recordedRules(f *fakeEC2) []string {
+	var rules []string
+	for _, call := range f.calls {
+		switch in := call.(type) {
+		case *ec2.AuthorizeSecurityGroupIngressInput:
+			rules = append(rules, "authorize "+describePermissions(in.IpPermissions))
+		case *ec2.RevokeSecurityGroupIngressInput:
+			rules = append(rules, "revoke "+describePermissions(in.IpPermissions))
+		}
+	}
+	return rules
+}
+
+func TestPlanApply(t *testing.T) {
+	f := newFakeClients()
+	f.iam.addUser("alice")
+	f.iam.addAccessKey("alice", "AKIASTALE", time.Now().AddDate(-1, 0, 0))
+	f.s3.addBucket("plain")
+	f.ec2.addVPC("vpc-1")
+	f.ec2.addSecurityGroup("vpc-1", "sg-1", "web", sshFrom("0.0.0.0/0"))
+	f.cloudTrail.addTrail("main", true)
+
+	ctx := context.Background()
+	a, err := newFakeAWS(ctx, f)
+	if err != nil {
+		t.Fatalf("NewAWSWithClients() error = %v", err)
+	}
+	plan, err := a.Plan(ctx, RemediateOptions{FlowLogDestination: "arn:aws:s3:::flow-logs"})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+
+	var got []string
+	for _, act := range plan.Actions {
+		got = append(got, act.RuleID+" "+act.Resource.Name)
+	}
+	want := []string{
+		"AWS-IAM-002 AKIASTALE",
+		"AWS-S3-001 plain",
+		"AWS-VPC-001 vpc-1",
+		"AWS-VPC-003 sg-1",
+		"AWS-CT-003 main",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Plan() actions = %v, want %v", got, want)
+	}
+	if len(f.iam.calls)+len(f.s3.calls)+len(f.ec2.calls)+len(f.cloudTrail.calls) > 0 {
+		t.Fatal("Plan() changed resources")
+	}
+
+	for i := range plan.Actions {
+		if err := plan.Actions[i].Apply(ctx); err != nil {
+			t.Errorf("Apply() of %s error = %v", plan.Actions[i].Description, err)
+		}
+		if plan.Actions[i].Status != ActionApplied {
+			t.Errorf("action %s status = %s, want %s", plan.Actions[i].Description, plan.Actions[i].Status, ActionApplied)
+		}
+	}
+
+	wantCalls := []struct {
+		service string
+		got     []interface{}
+		want    []interface{}
+	}{
+		{"IAM", f.iam.calls, []interface{}{&iam.UpdateAccessKeyInput{
+			UserName:    aws.String("alice"),
+			AccessKeyId: aws.String("AKIASTALE"),
+			Status:      aws.String(iam.StatusTypeInactive),
+		}}},
+		{"S3", f.s3.calls, []interface{}{&s3.PutBucketEncryptionInput{
+			Bucket: aws.String("plain"),
+			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+				Rules: []*s3.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+						SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+					},
+				}},
+			},
+		}}},
+		{"EC2", f.ec2.calls, []interface{}{
+			&ec2.CreateFlowLogsInput{
+				ResourceType:       aws.String(ec2.FlowLogsResourceTypeVpc),
+				ResourceIds:        []*string{aws.String("vpc-1")},
+				TrafficType:        aws.String(ec2.TrafficTypeReject),
+				LogDestinationType: aws.String(ec2.LogDestinationTypeS3),
+				LogDestination:     aws.String("arn:aws:s3:::flow-logs"),
+			},
+			&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String("sg-1"),
+				IpPermissions: []*ec2.IpPermission{sshFrom("0.0.0.0/0")},
+			},
+		}},
+		{"CloudTrail", f.cloudTrail.calls, []interface{}{&cloudtrail.UpdateTrailInput{
+			Name:                    aws.String("arn:aws:cloudtrail:us-east-1:111122223333:trail/main"),
+			EnableLogFileValidation: aws.Bool(true),
+		}}},
+	}
+	for _, c := range wantCalls {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s calls = %v, want %v", c.service, c.got, c.want)
+		}
+	}
+}
+
+func TestPlanApplyFailure(t *testing.T) {
+	f := newFakeClients()
+	f.s3.addBucket("plain")
+	f.fail("PutBucketEncryption")
+
+	ctx := context.Background()
+	a, err := newFakeAWS(ctx, f, "AWS-S3-001")
+	if err != nil {
+		t.Fatalf("NewAWSWithClients() error = %v", err)
+	}
+	plan, err := a.Plan(ctx, RemediateOptions{})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(plan.Actions) != 1 {
+		t.Fatalf("Plan() actions = %+v, want 1", plan.Actions)
+	}
+	act := &plan.Actions[0]
+	if err := act.Apply(ctx); err == nil {
+		t.Error("Apply() succeeded, want an error")
+	}
+	if act.Status != ActionFailed || !strings.Contains(act.Error, "PutBucketEncryption") {
+		t.Errorf("action status = %s, error = %q, want %s", act.Status, act.Error, ActionFailed)
+	}
+}
+
+func TestSSHFix(t *testing.T) {
+	tests := []struct {
+		name string
+		perm *ec2.IpPermission
+		// authorizeErr is the error of every call authorizing rules
+		authorizeErr    error
+		wantDescription string
+		wantRules       []string
+		wantErr         bool
+	}{
+		{
+			name:            "SSH only",
+			perm:            sshFrom("0.0.0.0/0"),
+			wantDescription: "Revoke the inbound rules of security group sg-1 allowing SSH from anywhere (tcp 22 from 0.0.0.0/0)",
+			wantRules:       []string{"revoke tcp 22 from 0.0.0.0/0"},
+		},
+		{
+			name: "every port over IPv4 and IPv6",
+			perm: &ec2.IpPermission{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(0),
+				ToPort:     aws.Int64(65535),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}, {CidrIp: aws.String("10.0.0.0/8")}},
+				Ipv6Ranges: []*ec2.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+			},
+			wantDescription: "Revoke the inbound rules of security group sg-1 allowing SSH from anywhere " +
+				"(tcp 0-65535 from 0.0.0.0/0, ::/0), allowing their other ports again " +
+				"(tcp 0-21 from 0.0.0.0/0, ::/0; tcp 23-65535 from 0.0.0.0/0, ::/0)",
+			wantRules: []string{
+				"authorize tcp 0-21 from 0.0.0.0/0",
+				"authorize tcp 0-21 from ::/0",
+				"authorize tcp 23-65535 from 0.0.0.0/0",
+				"authorize tcp 23-65535 from ::/0",
+				"revoke tcp 0-65535 from 0.0.0.0/0, ::/0",
+			},
+		},
+		{
+			name: "range starting at SSH",
+			perm: &ec2.IpPermission{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(22),
+				ToPort:     aws.Int64(23),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			},
+			wantDescription: "Revoke the inbound rules of security group sg-1 allowing SSH from anywhere " +
+				"(tcp 22-23 from 0.0.0.0/0), allowing their other ports again (tcp 23 from 0.0.0.0/0)",
+			wantRules: []string{"authorize tcp 23 from 0.0.0.0/0", "revoke tcp 22-23 from 0.0.0.0/0"},
+		},
+		{
+			name: "other ports already allowed",
+			perm: &ec2.IpPermission{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(21),
+				ToPort:     aws.Int64(22),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			},
+			authorizeErr: awserr.New("InvalidPermission.Duplicate", "the rule already exists", nil),
+			wantDescription: "Revoke the inbound rules of security group sg-1 allowing SSH from anywhere " +
+				"(tcp 21-22 from 0.0.0.0/0), allowing their other ports again (tcp 21 from 0.0.0.0/0)",
+			wantRules: []string{"revoke tcp 21-22 from 0.0.0.0/0"},
+		},
+		{
+			name: "other ports cannot be allowed",
+			perm: &ec2.IpPermission{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(21),
+				ToPort:     aws.Int64(22),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			},
+			authorizeErr: awserr.New("AccessDenied", "not authorized", nil),
+			wantDescription: "Revoke the inbound rules of security group sg-1 allowing SSH from anywhere " +
+				"(tcp 21-22 from 0.0.0.0/0), allowing their other ports again (tcp 21 from 0.0.0.0/0)",
+			// The rule is kept rather than closing its other ports.
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeClients()
+			if tt.authorizeErr != nil {
+				f.errs["AuthorizeSecurityGroupIngress"] = tt.authorizeErr
+			}
+			sg := &ec2.SecurityGroup{GroupId: aws.String("sg-1"), IpPermissions: []*ec2.IpPermission{tt.perm}}
+			fix := sshFix(RegionInventory{Region: testRegion}, sg)
+			if fix.description != tt.wantDescription {
+				t.Errorf("description = %q, want %q", fix.description, tt.wantDescription)
+			}
+
+			err := fix.apply(context.Background(), fixEnv{clients: f, region: testRegion})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := recordedRules(f.ec2); !reflect.DeepEqual(got, tt.wantRules) {
+				t.Errorf("calls = %q, want %q", got, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestSSHRemediation(t *testing.T) {
+	sg := &ec2.SecurityGroup{
+		GroupId: aws.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(0),
+			ToPort:     aws.Int64(65535),
+			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+		}},
+	}
+	rem := sshRemediation(RegionInventory{Region: testRegion}, sg)
+
+	for _, want := range []string{"tcp 0-65535 from 0.0.0.0/0", "tcp 0-21 from 0.0.0.0/0; tcp 23-65535 from 0.0.0.0/0"} {
+		if !strings.Contains(rem.Text, want) {
+			t.Errorf("Text = %q, want it to mention %q", rem.Text, want)
+		}
+	}
+	wantCLI := `aws ec2 authorize-security-group-ingress --region us-east-1 --group-id sg-1 --ip-permissions ` +
+		`'[{"IpProtocol":"tcp","FromPort":0,"ToPort":21,"IpRanges":[{"CidrIp":"0.0.0.0/0"}]},` +
+		`{"IpProtocol":"tcp","FromPort":23,"ToPort":65535,"IpRanges":[{"CidrIp":"0.0.0.0/0"}]}]'` + "\n" +
+		`aws ec2 revoke-security-group-ingress --region us-east-1 --group-id sg-1 --ip-permissions ` +
+		`'[{"IpProtocol":"tcp","FromPort":0,"ToPort":65535,"IpRanges":[{"CidrIp":"0.0.0.0/0"}]}]'`
+	if rem.CLI != wantCLI {
+		t.Errorf("CLI = %s, want %s", rem.CLI, wantCLI)
+	}
+	for _, want := range []string{
+		`resource "aws_vpc_security_group_ingress_rule" "sg_1_tcp_0_21_ipv4"`,
+		`resource "aws_vpc_security_group_ingress_rule" "sg_1_tcp_23_65535_ipv4"`,
+	} {
+		if !strings.Contains(rem.Terraform, want) {
+			t.Errorf("Terraform = %s, want it to contain %s", rem.Terraform, want)
+		}
+	}
+	if !strings.Contains(rem.CloudFormation, "Ports23To65535FromAnywhereIpv4:") {
+		t.Errorf("CloudFormation = %s, want a rule allowing ports 23-65535", rem.CloudFormation)
+	}
+}
@@ -0,0 +1,536 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Remediation describes how to fix a non-compliant resource. Values the user
+// has to choose, e.g. the bucket flow logs are delivered to, are written as
+// <placeholders>.
+type Remediation struct {
+	// Text describes the fix
+	Text string `json:"text"`
+	// CLI holds AWS CLI commands applying the fix, one per line
+	CLI string `json:"cli,omitempty"`
+	// Terraform is a Terraform snippet declaring the fixed configuration
+	Terraform string `json:"terraform,omitempty"`
+	// CloudFormation is a CloudFormation YAML snippet declaring the fixed
+	// configuration
+	CloudFormation string `json:"cloudformation,omitempty"`
+}
+
+// remediate sets the remediation of res and returns res
+func (res Result) remediate(rem Remediation) Result {
+	res.Remediation = &rem
+	return res
+}
+
+// consoleMFARemediation fixes a console user without MFA
+func consoleMFARemediation(inv *Inventory, user IAMUser) Remediation {
+	name := aws.StringValue(user.User.UserName)
+	serial := inv.account().arn("iam", "", "mfa/"+name)
+	return Remediation{
+		Text: fmt.Sprintf("Assign an MFA device to user %s, or delete the user's login profile "+
+			"if they do not need console access.", name),
+		CLI: cli("aws iam create-virtual-mfa-device",
+			"--virtual-mfa-device-name", name,
+			"--outfile", name+"-mfa.png", "--bootstrap-method", "QRCodePNG") + "\n" +
+			cli("aws iam enable-mfa-device", "--user-name", name, "--serial-number", serial,
+				"--authentication-code1", "<code-1>", "--authentication-code2", "<code-2>"),
+	}
+}
+
+// accessKeyRemediation fixes an unused access key of user
+func accessKeyRemediation(user IAMUser, key IAMAccessKey) Remediation {
+	name := aws.StringValue(user.User.UserName)
+	keyID := aws.StringValue(key.Key.AccessKeyId)
+	return Remediation{
+		Text: fmt.Sprintf("Deactivate access key %s of user %s, then delete it once nothing breaks.",
+			keyID, name),
+		CLI: cli("aws iam update-access-key", "--user-name", name, "--access-key-id", keyID,
+			"--status", "Inactive"),
+	}
+}
+
+// adminPolicyRemediation fixes a policy with a statement allowing admin
+// access
+func adminPolicyRemediation(policy IAMPolicy) Remediation {
+	name := aws.StringValue(policy.Policy.PolicyName)
+	return Remediation{
+		Text: fmt.Sprintf("Replace the statement of policy %s allowing every action on every resource "+
+			"with the actions and resources its principals need, as a new default policy version.", name),
+		CLI: cli("aws iam create-policy-version", "--policy-arn", aws.StringValue(policy.Policy.Arn),
+			"--policy-document", "file://<least-privilege-policy>.json", "--set-as-default"),
+	}
+}
+
+// userPoliciesRemediation fixes a user with inline or managed policies
+func userPoliciesRemediation(user IAMUser) Remediation {
+	name := aws.StringValue(user.User.UserName)
+	var cmds []string
+	for _, policyName := range user.InlinePolicyNames {
+		cmds = append(cmds, cli("aws iam delete-user-policy", "--user-name", name,
+			"--policy-name", aws.StringValue(policyName)))
+	}
+	for _, policy := range user.AttachedPolicies {
+		cmds = append(cmds, cli("aws iam detach-user-policy", "--user-name", name,
+			"--policy-arn", aws.StringValue(policy.PolicyArn)))
+	}
+	return Remediation{
+		Text: fmt.Sprintf("Grant user %s the permissions of its policies through a group or role, "+
+			"then remove the policies from the user.", name),
+		CLI: cli("aws iam add-user-to-group", "--user-name", name, "--group-name", "<group>") + "\n" +
+			strings.Join(cmds, "\n"),
+	}
+}
+
+// bucketEncryptionRemediation fixes a bucket without default encryption
+func bucketEncryptionRemediation(bucket S3Bucket) Remediation {
+	name := aws.StringValue(bucket.Bucket.Name)
+	return Remediation{
+		Text: fmt.Sprintf("Enable default encryption on bucket %s.", name),
+		CLI: cli("aws s3api put-bucket-encryption", "--bucket", name,
+			"--server-side-encryption-configuration",
+			`{"Rules":[{"ApplyServerSideEncryptionByDefault":{"SSEAlgorithm":"AES256"}}]}`),
+		Terraform: fmt.Sprintf(`resource "aws_s3_bucket_server_side_encryption_configuration" %q {
+  bucket = %q
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+`, terraformName(name), name),
+		CloudFormation: fmt.Sprintf(`Type: AWS::S3::Bucket
+Properties:
+  BucketName: %s
+  BucketEncryption:
+    ServerSideEncryptionConfiguration:
+      - ServerSideEncryptionByDefault:
+          SSEAlgorithm: AES256
+`, name),
+	}
+}
+
+// flowLogsRemediation fixes a VPC without flow logs
+func flowLogsRemediation(region RegionInventory, vpc *ec2.Vpc) Remediation {
+	vpcID := aws.StringValue(vpc.VpcId)
+	return Remediation{
+		Text: fmt.Sprintf("Create a flow log for VPC %s delivering at least rejected traffic to S3 "+
+			"or CloudWatch Logs.", vpcID),
+		CLI: cli("aws ec2 create-flow-logs", "--region", region.Region,
+			"--resource-type", "VPC", "--resource-ids", vpcID, "--traffic-type", "REJECT",
+			"--log-destination-type", "s3", "--log-destination", "arn:aws:s3:::<log-bucket>"),
+		Terraform: fmt.Sprintf(`resource "aws_flow_log" %q {
+  vpc_id               = %q
+  traffic_type         = "REJECT"
+  log_destination_type = "s3"
+  log_destination      = "arn:aws:s3:::<log-bucket>"
+}
+`, terraformName(vpcID), vpcID),
+		CloudFormation: fmt.Sprintf(`Type: AWS::EC2::FlowLog
+Properties:
+  ResourceId: %s
+  ResourceType: VPC
+  TrafficType: REJECT
+  LogDestinationType: s3
+  LogDestination: arn:aws:s3:::<log-bucket>
+`, vpcID),
+	}
+}
+
+// defaultSecurityGroupRemediation fixes a default security group with rules
+func defaultSecurityGroupRemediation(region RegionInventory, sg *ec2.SecurityGroup) Remediation {
+	groupID := aws.StringValue(sg.GroupId)
+	var cmds []string
+	if len(sg.IpPermissions) > 0 {
+		cmds = append(cmds, cli("aws ec2 revoke-security-group-ingress", "--region", region.Region,
+			"--group-id", groupID, "--ip-permissions", ipPermissionsJSON(sg.IpPermissions)))
+	}
+	if len(sg.IpPermissionsEgress) > 0 {
+		cmds = append(cmds, cli("aws ec2 revoke-security-group-egress", "--region", region.Region,
+			"--group-id", groupID, "--ip-permissions", ipPermissionsJSON(sg.IpPermissionsEgress)))
+	}
+	return Remediation{
+		Text: fmt.Sprintf("Move resources using the default security group %s to purpose-built "+
+			"security groups, then remove all of its rules.", groupID),
+		CLI: strings.Join(cmds, "\n"),
+		// Terraform removes every rule of a default security group it
+		// manages without rules.
+		Terraform: fmt.Sprintf(`resource "aws_default_security_group" %q {
+  vpc_id = %q
+}
+`, terraformName(groupID), aws.StringValue(sg.VpcId)),
+	}
+}
+
+// sshRemediation fixes a security group allowing SSH from anywhere. Rules
+// whose port range is wider than SSH are replaced by rules allowing the rest
+// of their ports.
+func sshRemediation(region RegionInventory, sg *ec2.SecurityGroup) Remediation {
+	groupID := aws.StringValue(sg.GroupId)
+	open := openSSHPermissions(sg)
+	rest := permissionsWithoutSSH(open)
+
+	text := fmt.Sprintf("Remove the inbound rules of security group %s allowing SSH from anywhere (%s), "+
+		"and allow SSH only from known address ranges or use Session Manager.", groupID, describePermissions(open))
+	var cmds []string
+	if len(rest) > 0 {
+		text += fmt.Sprintf(" Allow the other ports of the rules again (%s) if they are needed.",
+			describePermissions(rest))
+		cmds = append(cmds, cli("aws ec2 authorize-security-group-ingress", "--region", region.Region,
+			"--group-id", groupID, "--ip-permissions", ipPermissionsJSON(rest)))
+	}
+	cmds = append(cmds, cli("aws ec2 revoke-security-group-ingress", "--region", region.Region,
+		"--group-id", groupID, "--ip-permissions", ipPermissionsJSON(open)))
+
+	// The open rules may be declared inline in the security group or as
+	// separate resources, so the snippets only declare their replacement.
+	terraform := fmt.Sprintf(`# Delete the rules allowing SSH from anywhere (%[1]s) from the
+# configuration of security group %[2]s, and replace them with:
+resource "aws_vpc_security_group_ingress_rule" %[3]q {
+  security_group_id = %[2]q
+  description       = "SSH from a known address range"
+  ip_protocol       = "tcp"
+  from_port         = 22
+  to_port           = 22
+  cidr_ipv4         = "<trusted-cidr>"
+}
+`, describePermissions(open), groupID, terraformName(groupID+"_ssh"))
+	cloudFormation := fmt.Sprintf(`# Delete the rules allowing SSH from anywhere (%[1]s) from the
+# template of security group %[2]s, and replace them with:
+Resources:
+  SSHFromTrustedRange:
+    Type: AWS::EC2::SecurityGroupIngress
+    Properties:
+      GroupId: %[2]s
+      Description: SSH from a known address range
+      IpProtocol: tcp
+      FromPort: 22
+      ToPort: 22
+      CidrIp: <trusted-cidr>
+`, describePermissions(open), groupID)
+	for _, rule := range singleRulePermissions(rest) {
+		protocol := aws.StringValue(rule.IpProtocol)
+		from, to := aws.Int64Value(rule.FromPort), aws.Int64Value(rule.ToPort)
+		family, cidr, cidrProperty := "ipv4", "", "CidrIp"
+		if len(rule.IpRanges) > 0 {
+			cidr = aws.StringValue(rule.IpRanges[0].CidrIp)
+		} else {
+			family, cidr, cidrProperty = "ipv6", aws.StringValue(rule.Ipv6Ranges[0].CidrIpv6), "CidrIpv6"
+		}
+
+		terraform += fmt.Sprintf(`
+resource "aws_vpc_security_group_ingress_rule" %q {
+  security_group_id = %q
+  ip_protocol       = %q
+  from_port         = %d
+  to_port           = %d
+  cidr_%s         = %q
+}
+`, terraformName(fmt.Sprintf("%s_%s_%d_%d_%s", groupID, protocol, from, to, family)),
+			groupID, protocol, from, to, family, cidr)
+		cloudFormation += fmt.Sprintf(`  Ports%dTo%dFromAnywhere%s:
+    Type: AWS::EC2::SecurityGroupIngress
+    Properties:
+      GroupId: %s
+      IpProtocol: %s
+      FromPort: %d
+      ToPort: %d
+      %s: %q
+`, from, to, strings.ToUpper(family[:1])+family[1:], groupID, protocol, from, to, cidrProperty, cidr)
+	}
+
+	return Remediation{
+		Text:           text,
+		CLI:            strings.Join(cmds, "\n"),
+		Terraform:      terraform,
+		CloudFormation: cloudFormation,
+	}
+}
+
+// openSSHPermissions returns the inbound permissions of sg allowing SSH from
+// anywhere, each with only the address ranges matching anywhere
+func openSSHPermissions(sg *ec2.SecurityGroup) []*ec2.IpPermission {
+	var perms []*ec2.IpPermission
+	for _, perm := range sg.IpPermissions {
+		if aws.StringValue(perm.IpProtocol) != "tcp" ||
+			aws.Int64Value(perm.FromPort) > 22 || aws.Int64Value(perm.ToPort) < 22 {
+			continue
+		}
+		open := &ec2.IpPermission{IpProtocol: perm.IpProtocol, FromPort: perm.FromPort, ToPort: perm.ToPort}
+		for _, r := range perm.IpRanges {
+			if aws.StringValue(r.CidrIp) == "0.0.0.0/0" {
+				open.IpRanges = append(open.IpRanges, r)
+			}
+		}
+		for _, r := range perm.Ipv6Ranges {
+			if aws.StringValue(r.CidrIpv6) == "::/0" {
+				open.Ipv6Ranges = append(open.Ipv6Ranges, r)
+			}
+		}
+		if len(open.IpRanges) > 0 || len(open.Ipv6Ranges) > 0 {
+			perms = append(perms, open)
+		}
+	}
+	return perms
+}
+
+// permissionsWithoutSSH returns permissions allowing the ports of perms other
+// than SSH from the same address ranges, e.g. tcp 0-21 and 23-65535 for tcp
+// 0-65535. Every perms must allow SSH. Ports allowed from an address range by
+// several of perms are allowed by one permission.
+func permissionsWithoutSSH(perms []*ec2.IpPermission) []*ec2.IpPermission {
+	type portRange struct{ from, to int64 }
+	var rest []*ec2.IpPermission
+	index := map[portRange]int{}
+	seen := map[string]bool{}
+	add := func(perm *ec2.IpPermission, from, to int64) {
+		if from > to {
+			return
+		}
+		ports := portRange{from, to}
+		i, ok := index[ports]
+		if !ok {
+			i = len(rest)
+			index[ports] = i
+			rest = append(rest, &ec2.IpPermission{
+				IpProtocol: perm.IpProtocol,
+				FromPort:   aws.Int64(from),
+				ToPort:     aws.Int64(to),
+			})
+		}
+		for _, r := range perm.IpRanges {
+			if k := fmt.Sprint(from, to, aws.StringValue(r.CidrIp)); !seen[k] {
+				seen[k] = true
+				rest[i].IpRanges = append(rest[i].IpRanges, r)
+			}
+		}
+		for _, r := range perm.Ipv6Ranges {
+			if k := fmt.Sprint(from, to, aws.StringValue(r.CidrIpv6)); !seen[k] {
+				seen[k] = true
+				rest[i].Ipv6Ranges = append(rest[i].Ipv6Ranges, r)
+			}
+		}
+	}
+	for _, perm := range perms {
+		add(perm, aws.Int64Value(perm.FromPort), 21)
+		add(perm, 23, aws.Int64Value(perm.ToPort))
+	}
+	return rest
+}
+
+// singleRulePermissions splits perms into permissions of a single address
+// range each, i.e. a single security group rule
+func singleRulePermissions(perms []*ec2.IpPermission) []*ec2.IpPermission {
+	var rules []*ec2.IpPermission
+	for _, perm := range perms {
+		for _, r := range perm.IpRanges {
+			rules = append(rules, &ec2.IpPermission{IpProtocol: perm.IpProtocol, FromPort: perm.FromPort,
+				ToPort: perm.ToPort, IpRanges: []*ec2.IpRange{r}})
+		}
+		for _, r := range perm.Ipv6Ranges {
+			rules = append(rules, &ec2.IpPermission{IpProtocol: perm.IpProtocol, FromPort: perm.FromPort,
+				ToPort: perm.ToPort, Ipv6Ranges: []*ec2.Ipv6Range{r}})
+		}
+	}
+	return rules
+}
+
+// describePermissions describes perms, e.g. "tcp 0-65535 from 0.0.0.0/0,
+// ::/0"
+func describePermissions(perms []*ec2.IpPermission) string {
+	var descriptions []string
+	for _, perm := range perms {
+		ports := fmt.Sprintf("%d-%d", aws.Int64Value(perm.FromPort), aws.Int64Value(perm.ToPort))
+		if aws.Int64Value(perm.FromPort) == aws.Int64Value(perm.ToPort) {
+			ports = fmt.Sprint(aws.Int64Value(perm.FromPort))
+		}
+		var cidrs []string
+		for _, r := range perm.IpRanges {
+			cidrs = append(cidrs, aws.StringValue(r.CidrIp))
+		}
+		for _, r := range perm.Ipv6Ranges {
+			cidrs = append(cidrs, aws.StringValue(r.CidrIpv6))
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s %s from %s",
+			aws.StringValue(perm.IpProtocol), ports, strings.Join(cidrs, ", ")))
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// trailEncryptionRemediation fixes a trail whose logs are not encrypted
+func trailEncryptionRemediation(trail CloudTrailTrail) Remediation {
+	name := aws.StringValue(trail.Trail.Name)
+	bucket := aws.StringValue(trail.Trail.S3BucketName)
+	return Remediation{
+		Text: fmt.Sprintf("Encrypt the log files of trail %s with a KMS key whose key policy "+
+			"allows CloudTrail to use it.", name),
+		CLI: cli("aws cloudtrail update-trail", "--region", aws.StringValue(trail.Trail.HomeRegion),
+			"--name", name, "--kms-key-id", "<kms-key-arn>"),
+		Terraform: fmt.Sprintf(`resource "aws_cloudtrail" %q {
+  name           = %q
+  s3_bucket_name = %q
+  kms_key_id     = "<kms-key-arn>"
+}
+`, terraformName(name), name, bucket),
+		CloudFormation: fmt.Sprintf(`Type: AWS::CloudTrail::Trail
+Properties:
+  TrailName: %s
+  S3BucketName: %s
+  IsLogging: true
+  KMSKeyId: <kms-key-arn>
+`, name, bucket),
+	}
+}
+
+// multiRegionTrailRemediation fixes an account without a multi-region trail
+func multiRegionTrailRemediation() Remediation {
+	const name = "multi-region"
+	return Remediation{
+		Text: "Create a multi-region trail logging all management events.",
+		CLI: cli("aws cloudtrail create-trail", "--name", name, "--s3-bucket-name", "<log-bucket>",
+			"--is-multi-region-trail", "--enable-log-file-validation") + "\n" +
+			cli("aws cloudtrail start-logging", "--name", name),
+		Terraform: fmt.Sprintf(`resource "aws_cloudtrail" "multi_region" {
+  name                          = %q
+  s3_bucket_name                = "<log-bucket>"
+  is_multi_region_trail         = true
+  include_global_service_events = true
+  enable_log_file_validation    = true
+}
+`, name),
+		CloudFormation: fmt.Sprintf(`Type: AWS::CloudTrail::Trail
+Properties:
+  TrailName: %s
+  S3BucketName: <log-bucket>
+  IsLogging: true
+  IsMultiRegionTrail: true
+  IncludeGlobalServiceEvents: true
+  EnableLogFileValidation: true
+`, name),
+	}
+}
+
+// logValidationRemediation fixes a trail without log file validation
+func logValidationRemediation(trail CloudTrailTrail) Remediation {
+	name := aws.StringValue(trail.Trail.Name)
+	bucket := aws.StringValue(trail.Trail.S3BucketName)
+	return Remediation{
+		Text: fmt.Sprintf("Enable log file validation on trail %s.", name),
+		CLI: cli("aws cloudtrail update-trail", "--region", aws.StringValue(trail.Trail.HomeRegion),
+			"--name", name, "--enable-log-file-validation"),
+		Terraform: fmt.Sprintf(`resource "aws_cloudtrail" %q {
+  name                       = %q
+  s3_bucket_name             = %q
+  enable_log_file_validation = true
+}
+`, terraformName(name), name, bucket),
+		CloudFormation: fmt.Sprintf(`Type: AWS::CloudTrail::Trail
+Properties:
+  TrailName: %s
+  S3BucketName: %s
+  IsLogging: true
+  EnableLogFileValidation: true
+`, name, bucket),
+	}
+}
+
+// cli returns a shell command of command followed by args, quoting args as
+// needed
+func cli(command string, args ...string) string {
+	parts := []string{command}
+	for _, arg := range args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell unless it only has safe characters
+func shellQuote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+var terraformNameRe = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// terraformName returns a Terraform resource name derived from s
+func terraformName(s string) string {
+	name := terraformNameRe.ReplaceAllString(strings.ToLower(s), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "r_" + name
+	}
+	return name
+}
+
+// ipPermission is an ec2.IpPermission in the JSON accepted by the AWS CLI,
+// without the unset fields
+type ipPermission struct {
+	IpProtocol       string             `json:"IpProtocol"`
+	FromPort         *int64             `json:"FromPort,omitempty"`
+	ToPort           *int64             `json:"ToPort,omitempty"`
+	IpRanges         []ipRange          `json:"IpRanges,omitempty"`
+	Ipv6Ranges       []ipv6Range        `json:"Ipv6Ranges,omitempty"`
+	PrefixListIds    []prefixListID     `json:"PrefixListIds,omitempty"`
+	UserIdGroupPairs []userIDGroupPairs `json:"UserIdGroupPairs,omitempty"`
+}
+
+type ipRange struct {
+	CidrIp string `json:"CidrIp"`
+}
+
+type ipv6Range struct {
+	CidrIpv6 string `json:"CidrIpv6"`
+}
+
+type prefixListID struct {
+	PrefixListId string `json:"PrefixListId"`
+}
+
+type userIDGroupPairs struct {
+	GroupId string `json:"GroupId"`
+	UserId  string `json:"UserId,omitempty"`
+}
+
+// ipPermissionsJSON returns perms as the JSON accepted by the
+// --ip-permissions option of the AWS CLI
+func ipPermissionsJSON(perms []*ec2.IpPermission) string {
+	var out []ipPermission
+	for _, perm := range perms {
+		p := ipPermission{
+			IpProtocol: aws.StringValue(perm.IpProtocol),
+			FromPort:   perm.FromPort,
+			ToPort:     perm.ToPort,
+		}
+		for _, r := range perm.IpRanges {
+			p.IpRanges = append(p.IpRanges, ipRange{CidrIp: aws.StringValue(r.CidrIp)})
+		}
+		for _, r := range perm.Ipv6Ranges {
+			p.Ipv6Ranges = append(p.Ipv6Ranges, ipv6Range{CidrIpv6: aws.StringValue(r.CidrIpv6)})
+		}
+		for _, l := range perm.PrefixListIds {
+			p.PrefixListIds = append(p.PrefixListIds, prefixListID{PrefixListId: aws.StringValue(l.PrefixListId)})
+		}
+		for _, pair := range perm.UserIdGroupPairs {
+			p.UserIdGroupPairs = append(p.UserIdGroupPairs, userIDGroupPairs{
+				GroupId: aws.StringValue(pair.GroupId),
+				UserId:  aws.StringValue(pair.UserId),
+			})
+		}
+		out = append(out, p)
+	}
+	// Marshalling these types cannot fail.
+	data, _ := json.Marshal(out)
+	return string(data)
+}
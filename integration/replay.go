@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// fixture is a recorded AWS API request and its response
+type fixture struct {
+	Request  fixtureRequest  `json:"request"`
+	Response fixtureResponse `json:"response"`
+}
+
+type fixtureRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Target is the X-Amz-Target header used by JSON protocol APIs such as
+	// CloudTrail to name the operation
+	Target string `json:"target,omitempty"`
+	Body   string `json:"body"`
+}
+
+type fixtureResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// newFixtureRequest reads req's body, restoring it so req can still be sent
+func newFixtureRequest(req *http.Request) (fixtureRequest, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return fixtureRequest{}, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return fixtureRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Target: req.Header.Get("X-Amz-Target"),
+		Body:   string(body),
+	}, nil
+}
+
+// path returns the path of the fixture file for r in dir. Only the parts of
+// the request that identify the call are used, so signatures and timestamps
+// do not matter.
+func (r fixtureRequest) path(dir string) string {
+	h := sha256.New()
+	for _, s := range []string{r.Method, r.URL, r.Target, r.Body} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// fixtureDir is a directory AWS API calls are recorded to or replayed from.
+// The calls of an account accessed through an assumed role, such as an
+// organization member account, are kept in a subdirectory named by its
+// account ID, since they are otherwise identical to those of every other
+// account.
+type fixtureDir struct {
+	dir string
+	// next sends the recorded requests. It is nil when replaying.
+	next http.RoundTripper
+}
+
+// client returns an HTTP client recording or replaying the calls of
+// account, or of the account of the caller's own credentials if account is
+// empty
+func (f *fixtureDir) client(account string) *http.Client {
+	dir := filepath.Join(f.dir, account)
+	if f.next == nil {
+		return &http.Client{Transport: &replayTransport{dir: dir}}
+	}
+	return &http.Client{Transport: &recordTransport{dir: dir, next: f.next}}
+}
+
+// recordTransport sends requests with next and saves every request and
+// response to dir
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fr, err := newFixtureRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := fixture{
+		Request: fr,
+		Response: fixtureResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       string(body),
+		},
+	}
+	if err := writeFixture(fr.path(t.dir), f); err != nil {
+		return nil, fmt.Errorf("recording %s %s: %w", fr.Method, fr.URL, err)
+	}
+	return resp, nil
+}
+
+// writeFixture atomically writes f to path, so concurrent identical requests
+// never leave a partially written file behind
+func writeFixture(path string, f fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fixture-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// replayTransport answers requests with the responses recorded in dir,
+// without using the network
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fr, err := newFixtureRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(fr.path(t.dir))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded response for %s %s %s", fr.Method, fr.URL, fr.Target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("reading fixture for %s %s: %w", fr.Method, fr.URL, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.StatusCode, http.StatusText(f.Response.StatusCode)),
+		StatusCode:    f.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Response.Header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Response.Body))),
+		ContentLength: int64(len(f.Response.Body)),
+		Request:       req,
+	}, nil
+}
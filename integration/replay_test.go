@@ -0,0 +1,57 @@
+package integration
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	setBaseCredentials(t)
+	ts := httptest.NewServer(&fakeOrganizationServer{})
+	defer ts.Close()
+
+	ctx := context.Background()
+	opts := Options{
+		Region:    "us-east-1",
+		Regions:   []string{"us-east-1"},
+		Endpoints: Endpoints{URL: ts.URL},
+		Filter:    RuleFilter{Rules: []string{"AWS-IAM-003", "AWS-IAM-006"}},
+	}
+	check := func(opts Options) []Result {
+		t.Helper()
+		a, err := NewAWS(ctx, opts)
+		if err != nil {
+			t.Fatalf("NewAWS() error = %v", err)
+		}
+		res, err := a.Check(ctx)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		return res
+	}
+
+	recordOpts := opts
+	recordOpts.RecordDir = t.TempDir()
+	recorded := check(recordOpts)
+	if len(recorded) == 0 {
+		t.Fatal("no results were recorded")
+	}
+
+	// Replaying must not reach the server.
+	ts.Close()
+	replayOpts := opts
+	replayOpts.ReplayDir = recordOpts.RecordDir
+	if replayed := check(replayOpts); !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed results = %+v, want the recorded %+v", replayed, recorded)
+	}
+
+	missingOpts := opts
+	missingOpts.ReplayDir = t.TempDir()
+	_, err := NewAWS(ctx, missingOpts)
+	if err == nil || !strings.Contains(err.Error(), "no recorded response for POST "+ts.URL) {
+		t.Errorf("NewAWS() error = %v, want a missing recording error", err)
+	}
+}
@@ -0,0 +1,162 @@
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of a scan
+type Report struct {
+	Summary Summary  `json:"summary"`
+	Results []Result `json:"results"`
+	// Errors lists every rule and resource that could not be checked
+	Errors []CheckError `json:"errors"`
+	// Accounts summarizes the results of every account, in the order the
+	// accounts were checked
+	Accounts []AccountSummary `json:"accounts"`
+	// Waivers lists every waiver that had not expired at the time of the scan
+	Waivers []Waiver `json:"waivers"`
+}
+
+// Summary counts the results of a scan by status
+type Summary struct {
+	Total        int `json:"total"`
+	Compliant    int `json:"compliant"`
+	NonCompliant int `json:"non_compliant"`
+	Waived       int `json:"waived"`
+	Errors       int `json:"errors"`
+}
+
+// add counts res in s
+func (s *Summary) add(res Result) {
+	s.Total++
+	switch res.Status {
+	case StatusCompliant:
+		s.Compliant++
+	case StatusNonCompliant:
+		s.NonCompliant++
+	case StatusWaived:
+		s.Waived++
+	case StatusError:
+		s.Errors++
+	}
+}
+
+// AccountSummary counts the results of one AWS account by status
+type AccountSummary struct {
+	AccountID string `json:"account_id"`
+	Summary
+}
+
+// CheckError describes a rule that could not be checked against a resource
+type CheckError struct {
+	RuleID   string   `json:"rule_id"`
+	Resource Resource `json:"resource"`
+	Error    string   `json:"error"`
+}
+
+// NewReport returns a Report of the given results and the waivers applied to
+// them
+func NewReport(results []Result, waivers []Waiver) *Report {
+	r := &Report{
+		Results:  results,
+		Errors:   []CheckError{},
+		Accounts: []AccountSummary{},
+		Waivers:  activeWaivers(waivers, time.Now()),
+	}
+	accountIdx := map[string]int{}
+	for _, res := range results {
+		r.Summary.add(res)
+
+		id := res.Resource.AccountID
+		i, ok := accountIdx[id]
+		if !ok {
+			i = len(r.Accounts)
+			accountIdx[id] = i
+			r.Accounts = append(r.Accounts, AccountSummary{AccountID: id})
+		}
+		r.Accounts[i].add(res)
+
+		if res.Status != StatusError {
+			continue
+		}
+		r.Errors = append(r.Errors, CheckError{
+			RuleID:   res.RuleID,
+			Resource: res.Resource,
+			Error:    res.Reason,
+		})
+	}
+	return r
+}
+
+// HasErrors reports whether any rule could not be checked
+func (r *Report) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// FailPolicy decides which non-compliant results fail a scan. The zero value
+// fails every non-compliant result.
+type FailPolicy struct {
+	// MinSeverity, if set, fails results at least this severe
+	MinSeverity Severity
+	// RuleIDs fails results of these rules
+	RuleIDs []string
+}
+
+// ParseFailPolicy parses a comma-separated list of rule IDs and at most one
+// severity threshold, e.g. "high,AWS-S3-001". An empty string returns the zero
+// FailPolicy.
+func ParseFailPolicy(s string) (FailPolicy, error) {
+	var p FailPolicy
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if sev, err := ParseSeverity(field); err == nil {
+			if p.MinSeverity != "" {
+				return FailPolicy{}, fmt.Errorf("more than one severity threshold in %q", s)
+			}
+			p.MinSeverity = sev
+			continue
+		}
+		if _, ok := LookupRule(field); !ok {
+			return FailPolicy{}, fmt.Errorf("%q is neither a severity nor a known rule ID", field)
+		}
+		p.RuleIDs = append(p.RuleIDs, field)
+	}
+	return p, nil
+}
+
+// Fails reports whether res fails the scan under p
+func (p FailPolicy) Fails(res Result) bool {
+	if res.Status != StatusNonCompliant {
+		return false
+	}
+	if p.MinSeverity == "" && len(p.RuleIDs) == 0 {
+		return true
+	}
+
+	if p.MinSeverity != "" && res.Severity.AtLeast(p.MinSeverity) {
+		return true
+	}
+	for _, id := range p.RuleIDs {
+		if res.RuleID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Failures returns the results that fail the scan under p
+func (r *Report) Failures(p FailPolicy) []Result {
+	var failures []Result
+	for _, res := range r.Results {
+		if p.Fails(res) {
+			failures = append(failures, res)
+		}
+	}
+	return failures
+}
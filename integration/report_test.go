@@ -0,0 +1,75 @@
+package integration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFailPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want FailPolicy
+		// err is part of the wanted error, if any
+		err string
+	}{
+		{in: ""},
+		{in: " , "},
+		{in: "high", want: FailPolicy{MinSeverity: SeverityHigh}},
+		{in: "CRITICAL", want: FailPolicy{MinSeverity: SeverityCritical}},
+		{
+			in:   "high,AWS-IAM-006",
+			want: FailPolicy{MinSeverity: SeverityHigh, RuleIDs: []string{"AWS-IAM-006"}},
+		},
+		{
+			in:   "AWS-S3-001, AWS-IAM-006",
+			want: FailPolicy{RuleIDs: []string{"AWS-S3-001", "AWS-IAM-006"}},
+		},
+		{in: "high,low", err: "more than one severity threshold"},
+		{in: "severe", err: `"severe" is neither a severity nor a known rule ID`},
+		{in: "high,AWS-XYZ-001", err: `"AWS-XYZ-001" is neither a severity nor a known rule ID`},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFailPolicy(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ParseFailPolicy(%q) error = %v, want one containing %q", tt.in, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFailPolicy(%q) error = %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFailPolicy(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailPolicyFails(t *testing.T) {
+	finding := func(ruleID string, severity Severity, status Status) Result {
+		return Result{RuleID: ruleID, Severity: severity, Status: status}
+	}
+	policy := FailPolicy{MinSeverity: SeverityHigh, RuleIDs: []string{"AWS-S3-001"}}
+	for _, tt := range []struct {
+		name   string
+		policy FailPolicy
+		res    Result
+		want   bool
+	}{
+		{"any finding", FailPolicy{}, finding("AWS-VPC-001", SeverityLow, StatusNonCompliant), true},
+		{"compliant", FailPolicy{}, finding("AWS-VPC-001", SeverityLow, StatusCompliant), false},
+		{"waived", FailPolicy{}, finding("AWS-VPC-001", SeverityLow, StatusWaived), false},
+		{"error", FailPolicy{}, finding("AWS-VPC-001", SeverityLow, StatusError), false},
+		{"severe enough", policy, finding("AWS-IAM-006", SeverityCritical, StatusNonCompliant), true},
+		{"not severe enough", policy, finding("AWS-VPC-001", SeverityMedium, StatusNonCompliant), false},
+		{"listed rule", policy, finding("AWS-S3-001", SeverityLow, StatusNonCompliant), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Fails(tt.res); got != tt.want {
+				t.Errorf("%+v.Fails(%+v) = %v, want %v", tt.policy, tt.res, got, tt.want)
+			}
+		})
+	}
+}
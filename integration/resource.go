@@ -1,13 +1,134 @@
 package integration
 
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// Status is the outcome of checking a rule against a resource
+type Status string
+
+// Statuses a Result can have
+const (
+	StatusCompliant    Status = "compliant"
+	StatusNonCompliant Status = "non_compliant"
+	// StatusError means the rule could not be checked against the resource
+	StatusError Status = "error"
+	// StatusWaived means the resource is non-compliant, but an active
+	// waiver accepts the risk
+	StatusWaived Status = "waived"
+)
+
 type Result struct {
 	Resource  Resource `json:"resource"`
+	RuleID    string   `json:"rule_id"`
 	Rule      string   `json:"rule"`
+	Service   string   `json:"service"`
+	Severity  Severity `json:"severity"`
+	Criteria  []string `json:"criteria"`
+	Status    Status   `json:"status"`
 	Compliant bool     `json:"compliant"`
 	Reason    string   `json:"reason"`
+	// Waiver is the waiver that accepts the result, if its status is
+	// StatusWaived
+	Waiver *Waiver `json:"waiver,omitempty"`
+	// Remediation describes how to fix the resource, if it is non-compliant
+	Remediation *Remediation `json:"remediation,omitempty"`
+
+	// fix is the change fixing the resource, if plio can make it
+	fix *fix
 }
 
 type Resource struct {
 	Type string `json:"type"`
+	// Name is the resource's name or ID, e.g. an IAM user name or a VPC ID
 	Name string `json:"name"`
+	// ARN is the resource's canonical Amazon Resource Name, if it has one
+	ARN string `json:"arn,omitempty"`
+	// AccountID is the ID of the AWS account that owns the resource
+	AccountID string `json:"account_id,omitempty"`
+	// Region is the resource's region. It is empty for global resources, e.g.
+	// IAM users.
+	Region string `json:"region,omitempty"`
+	// Tags are the resource's AWS tags. They are nil for resources that
+	// cannot be tagged.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// ID returns a string that uniquely identifies r across accounts and
+// regions: its ARN if it has one, otherwise its account, region, type and
+// name
+func (r Resource) ID() string {
+	if r.ARN != "" {
+		return r.ARN
+	}
+	return strings.Join([]string{r.AccountID, r.Region, r.Type, r.Name}, "/")
+}
+
+// newResult returns the Result of checking a rule against resource
+func newResult(resource Resource, compliant bool, reason string) Result {
+	status := StatusNonCompliant
+	if compliant {
+		status = StatusCompliant
+	}
+	return Result{
+		Resource:  resource,
+		Status:    status,
+		Compliant: compliant,
+		Reason:    reason,
+	}
+}
+
+// errorResult returns the Result of failing to check a rule against resource
+func errorResult(resource Resource, err error) Result {
+	return Result{
+		Resource: resource,
+		Status:   StatusError,
+		Reason:   err.Error(),
+	}
+}
+
+func regionResource(accountID, region string) Resource {
+	return Resource{
+		Type:      "aws/region",
+		Name:      region,
+		AccountID: accountID,
+		Region:    region,
+	}
+}
+
+// awsAccount is the AWS account being checked
+type awsAccount struct {
+	ID string
+	// Partition is the account's partition, e.g. aws or aws-cn
+	Partition string
+}
+
+// withID returns a with its ID replaced by id, unless id is empty
+func (a awsAccount) withID(id string) awsAccount {
+	if id != "" {
+		a.ID = id
+	}
+	return a
+}
+
+// partition returns a's partition, defaulting to the standard aws partition
+func (a awsAccount) partition() string {
+	if a.Partition == "" {
+		return "aws"
+	}
+	return a.Partition
+}
+
+// arn returns the ARN of a resource of service owned by a. region is empty
+// for global resources.
+func (a awsAccount) arn(service, region, resource string) string {
+	return arn.ARN{
+		Partition: a.partition(),
+		Service:   service,
+		Region:    region,
+		AccountID: a.ID,
+		Resource:  resource,
+	}.String()
 }
@@ -0,0 +1,349 @@
+package integration
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Service names that rules are grouped by
+const (
+	ServiceIAM        = "iam"
+	ServiceS3         = "s3"
+	ServiceVPC        = "vpc"
+	ServiceCloudTrail = "cloudtrail"
+)
+
+// Services lists every service name
+var Services = []string{ServiceIAM, ServiceS3, ServiceVPC, ServiceCloudTrail}
+
+// Severity is how serious a rule violation is
+type Severity string
+
+// Severity levels in increasing order of seriousness
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// severities lists every severity in increasing order of seriousness
+var severities = []Severity{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// ParseSeverity returns the severity named s
+func ParseSeverity(s string) (Severity, error) {
+	for _, sev := range severities {
+		if string(sev) == strings.ToLower(s) {
+			return sev, nil
+		}
+	}
+	return "", fmt.Errorf("unknown severity %q, must be one of %v", s, severities)
+}
+
+// AtLeast reports whether s is at least as serious as other
+func (s Severity) AtLeast(other Severity) bool {
+	return s.rank() >= other.rank()
+}
+
+// rank orders severities; unknown severities rank lowest
+func (s Severity) rank() int {
+	for i, sev := range severities {
+		if s == sev {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Rule is a single compliance rule that is checked against one service
+type Rule struct {
+	// ID uniquely identifies the rule
+	ID string
+	// Title describes what the rule requires
+	Title string
+	// Service is the service the rule is checked against, e.g. ServiceIAM
+	Service string
+	// Severity is how serious a violation of the rule is
+	Severity Severity
+	// Criteria are the SOC2 Trust Services Criteria the rule satisfies, e.g.
+	// CC6.1
+	Criteria []string
+	// Rationale explains why the rule matters
+	Rationale string
+	// APICalls are the AWS API calls whose responses the rule inspects, as
+	// service:Operation, e.g. iam:ListUsers
+	APICalls []string
+	// Remediation describes how to fix a violation of the rule
+	Remediation string
+	// References are links to documentation and benchmarks about the rule
+	References []string
+	// Remediable reports whether plio can fix the rule's findings
+	Remediable bool
+	// Params are the rule's tunable parameters
+	Params []Param
+
+	check func(*Inventory, Params) ([]Result, error)
+}
+
+// Param is a tunable integer parameter of a rule, e.g. a number of days
+type Param struct {
+	Name        string
+	Description string
+	// Default is the value used when the parameter is not configured
+	Default int
+}
+
+// Params holds the values of a rule's parameters by name
+type Params map[string]int
+
+// Int returns the value of the named parameter
+func (p Params) Int(name string) int {
+	return p[name]
+}
+
+// params returns r's parameters with overrides applied over their defaults
+func (r Rule) params(overrides map[string]int) Params {
+	p := Params{}
+	for _, param := range r.Params {
+		p[param.Name] = param.Default
+		if v, ok := overrides[param.Name]; ok {
+			p[param.Name] = v
+		}
+	}
+	return p
+}
+
+// apiPermissions maps the API calls whose IAM action has another name to
+// that action
+var apiPermissions = map[string]string{
+	"s3:ListBuckets":         "s3:ListAllMyBuckets",
+	"s3:GetBucketEncryption": "s3:GetEncryptionConfiguration",
+}
+
+// Permissions returns the IAM actions required to make r's API calls
+func (r Rule) Permissions() []string {
+	var perms []string
+	for _, call := range r.APICalls {
+		if perm, ok := apiPermissions[call]; ok {
+			call = perm
+		}
+		if !contains(perms, call) {
+			perms = append(perms, call)
+		}
+	}
+	return perms
+}
+
+// ValidateParams checks that every rule ID and parameter name in params
+// exists. params maps rule IDs to parameter names to values.
+func ValidateParams(params map[string]map[string]int) error {
+	for id, values := range params {
+		r, ok := LookupRule(id)
+		if !ok {
+			return fmt.Errorf("parameters given for unknown rule %s", id)
+		}
+	NEXTVALUE:
+		for name := range values {
+			for _, param := range r.Params {
+				if param.Name == name {
+					continue NEXTVALUE
+				}
+			}
+			return fmt.Errorf("rule %s has no parameter %q", id, name)
+		}
+	}
+	return nil
+}
+
+// registry holds every registered rule in registration order
+var registry []Rule
+
+// Register adds a rule to the registry. check evaluates the rule against the
+// inventory of an account. Register panics if a rule with the same ID has
+// already been registered.
+func Register(r Rule, check func(*Inventory, Params) ([]Result, error)) {
+	if _, ok := LookupRule(r.ID); ok {
+		panic(fmt.Sprintf("rule %s registered twice", r.ID))
+	}
+
+	r.check = check
+	registry = append(registry, r)
+}
+
+// Rules returns every registered rule in registration order
+func Rules() []Rule {
+	return append([]Rule(nil), registry...)
+}
+
+// LookupRule returns the registered rule with the given ID
+func LookupRule(id string) (Rule, bool) {
+	for _, r := range registry {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// RuleFilter selects rules by ID and service. Rule IDs are matched against
+// glob patterns, e.g. AWS-IAM-*, using path.Match syntax.
+type RuleFilter struct {
+	// Rules, if set, selects only rules matching any of these patterns
+	Rules []string
+	// SkipRules excludes rules matching any of these patterns
+	SkipRules []string
+	// Services, if set, selects only rules of these services
+	Services []string
+}
+
+// Match reports whether f selects r
+func (f RuleFilter) Match(r Rule) bool {
+	if len(f.Services) > 0 && !contains(f.Services, r.Service) {
+		return false
+	}
+	if len(f.Rules) > 0 && !matchAny(f.Rules, r.ID) {
+		return false
+	}
+	return !matchAny(f.SkipRules, r.ID)
+}
+
+// SelectRules returns the registered rules selected by f in registration
+// order. It fails if f names an unknown service or has a pattern that matches
+// no rule, since that is most likely a typo.
+func SelectRules(f RuleFilter) ([]Rule, error) {
+	for _, service := range f.Services {
+		if !contains(Services, service) {
+			return nil, fmt.Errorf("unknown service %q, must be one of %v", service, Services)
+		}
+	}
+	for _, pattern := range append(append([]string(nil), f.Rules...), f.SkipRules...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid rule pattern %q: %w", pattern, err)
+		}
+		matched := false
+		for _, r := range registry {
+			if ok, _ := path.Match(pattern, r.ID); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("rule pattern %q matches no rule", pattern)
+		}
+	}
+
+	var rules []Rule
+	for _, r := range registry {
+		if f.Match(r) {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+// matchAny reports whether id matches any of patterns
+func matchAny(patterns []string, id string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceRules returns the rules of rules that belong to service
+func serviceRules(service string, rules []Rule) []Rule {
+	var res []Rule
+	for _, r := range rules {
+		if r.Service == service {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// ruleServices returns the services of rules in Services order
+func ruleServices(rules []Rule) []string {
+	var services []string
+	for _, service := range Services {
+		if len(serviceRules(service, rules)) > 0 {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// evaluateRules evaluates rules against inv and returns the results in
+// service and rule order. params overrides rule parameters by rule ID. A rule
+// that fails yields a StatusError result instead of an error.
+func evaluateRules(inv *Inventory, rules []Rule, params map[string]map[string]int) []Result {
+	// Every rule yields a StatusError result for an account that could not
+	// be accessed.
+	if err := collectErr(inv.Error); err != nil {
+		return errorResults(rules, accountResource(inv.AccountID), err)
+	}
+
+	var res []Result
+	for _, service := range Services {
+		for _, r := range serviceRules(service, rules) {
+			var (
+				ruleRes []Result
+				err     error
+			)
+			if contains(inv.Services, r.Service) {
+				ruleRes, err = r.check(inv, r.params(params[r.ID]))
+			} else {
+				// Only possible when evaluating a snapshot collected
+				// with other rules.
+				err = fmt.Errorf("service %s was not collected", r.Service)
+			}
+			if err != nil {
+				// The rule could not be checked at all, e.g. listing the
+				// resources failed. Report that rather than aborting the
+				// scan.
+				ruleRes = []Result{errorResult(
+					Resource{
+						Type:      "aws/" + r.Service,
+						Name:      "N/A",
+						AccountID: inv.AccountID,
+					},
+					err,
+				)}
+			}
+			res = append(res, r.stamp(ruleRes)...)
+		}
+	}
+	return res
+}
+
+// errorResults returns a StatusError result of resource for every rule
+func errorResults(rules []Rule, resource Resource, err error) []Result {
+	var res []Result
+	for _, r := range rules {
+		res = append(res, r.stamp([]Result{errorResult(resource, err)})...)
+	}
+	return res
+}
+
+// stamp sets the rule fields of every result to r's, and the remediation
+// text of non-compliant results that have none, and returns results
+func (r Rule) stamp(results []Result) []Result {
+	for i := range results {
+		results[i].RuleID = r.ID
+		results[i].Rule = r.Title
+		results[i].Service = r.Service
+		results[i].Severity = r.Severity
+		results[i].Criteria = r.Criteria
+		// Every finding can at least be fixed as described by the rule.
+		if results[i].Status == StatusNonCompliant {
+			if results[i].Remediation == nil {
+				results[i].Remediation = &Remediation{}
+			}
+			if results[i].Remediation.Text == "" {
+				results[i].Remediation.Text = r.Remediation
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectRules(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		filter RuleFilter
+		want   []string
+		// err is part of the wanted error, if any
+		err string
+	}{
+		{
+			name: "every rule",
+			want: []string{
+				"AWS-IAM-001", "AWS-IAM-002", "AWS-IAM-003", "AWS-IAM-004", "AWS-IAM-005", "AWS-IAM-006",
+				"AWS-S3-001",
+				"AWS-VPC-001", "AWS-VPC-002", "AWS-VPC-003",
+				"AWS-CT-001", "AWS-CT-002", "AWS-CT-003",
+			},
+		},
+		{
+			name:   "services",
+			filter: RuleFilter{Services: []string{ServiceS3, ServiceVPC}},
+			want:   []string{"AWS-S3-001", "AWS-VPC-001", "AWS-VPC-002", "AWS-VPC-003"},
+		},
+		{
+			name:   "rule globs",
+			filter: RuleFilter{Rules: []string{"AWS-VPC-*", "AWS-IAM-00[12]"}},
+			want:   []string{"AWS-IAM-001", "AWS-IAM-002", "AWS-VPC-001", "AWS-VPC-002", "AWS-VPC-003"},
+		},
+		{
+			name:   "rules of services",
+			filter: RuleFilter{Services: []string{ServiceCloudTrail}, Rules: []string{"*-001"}},
+			want:   []string{"AWS-CT-001"},
+		},
+		{
+			name:   "skipped rules",
+			filter: RuleFilter{Services: []string{ServiceIAM}, SkipRules: []string{"AWS-IAM-00[1-4]"}},
+			want:   []string{"AWS-IAM-005", "AWS-IAM-006"},
+		},
+		{
+			name:   "skipped rules override selected ones",
+			filter: RuleFilter{Rules: []string{"AWS-CT-*", "AWS-S3-001"}, SkipRules: []string{"AWS-CT-002", "AWS-S3-*"}},
+			want:   []string{"AWS-CT-001", "AWS-CT-003"},
+		},
+		{
+			name:   "nothing left",
+			filter: RuleFilter{Rules: []string{"AWS-S3-001"}, SkipRules: []string{"AWS-S3-001"}},
+		},
+		{
+			name:   "unknown service",
+			filter: RuleFilter{Services: []string{ServiceIAM, "rds"}},
+			err:    `unknown service "rds"`,
+		},
+		{
+			name:   "rule pattern matching no rule",
+			filter: RuleFilter{Rules: []string{"AWS-IAM-*", "AWS-RDS-*"}},
+			err:    `rule pattern "AWS-RDS-*" matches no rule`,
+		},
+		{
+			name:   "skip pattern matching no rule",
+			filter: RuleFilter{SkipRules: []string{"AWS-IAM-1*"}},
+			err:    `rule pattern "AWS-IAM-1*" matches no rule`,
+		},
+		{
+			name:   "invalid pattern",
+			filter: RuleFilter{Rules: []string{"AWS-[IAM"}},
+			err:    `invalid rule pattern "AWS-[IAM"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := SelectRules(tt.filter)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("SelectRules() error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectRules() error = %v", err)
+			}
+			var got []string
+			for _, r := range rules {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,504 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// wantResult is the expected status of the result of a resource
+type wantResult struct {
+	status Status
+	// resource is the name of the resource
+	resource string
+}
+
+// gotResults returns the statuses and resource names of results
+func gotResults(results []Result) []wantResult {
+	got := []wantResult{}
+	for _, res := range results {
+		got = append(got, wantResult{res.Status, res.Resource.Name})
+	}
+	return got
+}
+
+// addAccessKey adds an active access key of user last used at lastUsed
+func (f *fakeIAM) addAccessKey(user, id string, lastUsed time.Time) {
+	f.accessKeys[user] = append(f.accessKeys[user], []*iam.AccessKeyMetadata{{
+		AccessKeyId: aws.String(id),
+		UserName:    aws.String(user),
+		Status:      aws.String(iam.StatusTypeActive),
+	}})
+	f.lastUsed[id] = &iam.AccessKeyLastUsed{LastUsedDate: aws.Time(lastUsed)}
+}
+
+// consoleUser adds a user with a console password
+func consoleUser(f *fakeClients) {
+	f.iam.addUser("alice")
+	f.iam.loginProfiles["alice"] = &iam.LoginProfile{UserName: aws.String("alice")}
+}
+
+// sshFrom returns a permission allowing SSH from cidr
+func sshFrom(cidr string) *ec2.IpPermission {
+	return &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(22),
+		ToPort:     aws.Int64(22),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(cidr)}},
+	}
+}
+
+const (
+	adminPolicy  = `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"*","Resource":"*"}}`
+	scopedPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+)
+
+// ruleTest is a case of a rule checked against fake clients
+type ruleTest struct {
+	rule  string
+	name  string
+	setup func(f *fakeClients)
+	want  []wantResult
+}
+
+// ruleTests returns the cases of every rule, for a scan at now
+func ruleTests(now time.Time) []ruleTest {
+	return []ruleTest{
+		{
+			rule: "AWS-IAM-001",
+			name: "console user with MFA and user without console access",
+			setup: func(f *fakeClients) {
+				consoleUser(f)
+				f.iam.mfaDevices["alice"] = []*iam.MFADevice{{SerialNumber: aws.String("mfa/alice")}}
+				f.iam.addUser("ci")
+			},
+			want: []wantResult{{StatusCompliant, "alice"}, {StatusCompliant, "ci"}},
+		},
+		{
+			rule:  "AWS-IAM-001",
+			name:  "console user without MFA",
+			setup: consoleUser,
+			want:  []wantResult{{StatusNonCompliant, "alice"}},
+		},
+		{
+			rule: "AWS-IAM-001",
+			name: "MFA devices cannot be listed",
+			setup: func(f *fakeClients) {
+				consoleUser(f)
+				f.fail("ListMFADevices")
+			},
+			want: []wantResult{{StatusError, "alice"}},
+		},
+		{
+			rule: "AWS-IAM-001",
+			name: "users cannot be listed",
+			setup: func(f *fakeClients) {
+				f.fail("ListUsers")
+			},
+			want: []wantResult{{StatusError, "N/A"}},
+		},
+		{
+			rule: "AWS-IAM-002",
+			name: "access key used recently",
+			setup: func(f *fakeClients) {
+				f.iam.addUser("alice")
+				f.iam.addAccessKey("alice", "AKIARECENT", now.AddDate(0, 0, -1))
+			},
+			want: []wantResult{{StatusCompliant, "AKIARECENT"}},
+		},
+		{
+			rule: "AWS-IAM-002",
+			name: "access key unused for longer than max_unused_days",
+			setup: func(f *fakeClients) {
+				f.iam.addUser("alice")
+				f.iam.addAccessKey("alice", "AKIARECENT", now.AddDate(0, 0, -1))
+				f.iam.addAccessKey("alice", "AKIASTALE", now.AddDate(0, 0, -91))
+			},
+			want: []wantResult{{StatusCompliant, "AKIARECENT"}, {StatusNonCompliant, "AKIASTALE"}},
+		},
+		{
+			rule: "AWS-IAM-002",
+			name: "last use of access key cannot be fetched",
+			setup: func(f *fakeClients) {
+				f.iam.addUser("alice")
+				f.iam.addAccessKey("alice", "AKIASTALE", now.AddDate(0, 0, -91))
+				f.fail("GetAccessKeyLastUsed")
+			},
+			want: []wantResult{{StatusError, "AKIASTALE"}},
+		},
+		{
+			rule: "AWS-IAM-003",
+			name: "root account with MFA",
+			setup: func(f *fakeClients) {
+				f.iam.summary["AccountMFAEnabled"] = aws.Int64(1)
+			},
+			want: []wantResult{{StatusCompliant, "root"}},
+		},
+		{
+			rule: "AWS-IAM-003",
+			name: "root account without MFA",
+			setup: func(f *fakeClients) {
+				f.iam.summary["AccountMFAEnabled"] = aws.Int64(0)
+			},
+			want: []wantResult{{StatusNonCompliant, "root"}},
+		},
+		{
+			rule: "AWS-IAM-003",
+			name: "account summary cannot be fetched",
+			setup: func(f *fakeClients) {
+				f.fail("GetAccountSummary")
+			},
+			want: []wantResult{{StatusError, "N/A"}},
+		},
+		{
+			rule: "AWS-IAM-004",
+			name: "root account without access keys",
+			setup: func(f *fakeClients) {
+				f.iam.summary["AccountAccessKeysPresent"] = aws.Int64(0)
+			},
+			want: []wantResult{{StatusCompliant, "root"}},
+		},
+		{
+			rule: "AWS-IAM-004",
+			name: "root account with access keys",
+			setup: func(f *fakeClients) {
+				f.iam.summary["AccountAccessKeysPresent"] = aws.Int64(1)
+			},
+			want: []wantResult{{StatusNonCompliant, "root"}},
+		},
+		{
+			rule: "AWS-IAM-004",
+			name: "account summary cannot be fetched",
+			setup: func(f *fakeClients) {
+				f.fail("GetAccountSummary")
+			},
+			want: []wantResult{{StatusError, "N/A"}},
+		},
+		{
+			rule: "AWS-IAM-005",
+			name: "policy with scoped statements",
+			setup: func(f *fakeClients) {
+				f.iam.addPolicy("read-objects", scopedPolicy)
+			},
+			want: []wantResult{{StatusCompliant, "read-objects"}},
+		},
+		{
+			rule: "AWS-IAM-005",
+			name: "policy allowing every action on every resource",
+			setup: func(f *fakeClients) {
+				f.iam.addPolicy("read-objects", scopedPolicy)
+				f.iam.addPolicy("admin", adminPolicy)
+			},
+			want: []wantResult{{StatusCompliant, "read-objects"}, {StatusNonCompliant, "admin"}},
+		},
+		{
+			rule: "AWS-IAM-005",
+			name: "policy version cannot be fetched",
+			setup: func(f *fakeClients) {
+				f.iam.addPolicy("admin", adminPolicy)
+				f.fail("GetPolicyVersion")
+			},
+			want: []wantResult{{StatusError, "admin"}},
+		},
+		{
+			rule: "AWS-IAM-006",
+			name: "user without policies",
+			setup: func(f *fakeClients) {
+				f.iam.addUser("alice")
+			},
+			want: []wantResult{{StatusCompliant, "alice"}},
+		},
+		{
+			rule: "AWS-IAM-006",
+			name: "users with inline and managed policies",
+			setup: func(f *fakeClients) {
+				f.iam.addUser("alice")
+				f.iam.inlinePolicies["alice"] = []*string{aws.String("inline")}
+				f.iam.addUser("bob")
+				f.iam.attached["bob"] = []*iam.AttachedPolicy{{
+					PolicyName: aws.String("ReadOnlyAccess"),
+					PolicyArn:  aws.String("arn:aws:iam::aws:policy/ReadOnlyAccess"),
+				}}
+			},
+			want: []wantResult{{StatusNonCompliant, "alice"}, {StatusNonCompliant, "bob"}},
+		},
+		{
+			rule: "AWS-IAM-006",
+			name: "attached policies cannot be listed",
+			setup: func(f *fakeClients) {
+				f.iam.addUser("alice")
+				f.fail("ListAttachedUserPolicies")
+			},
+			want: []wantResult{{StatusError, "alice"}},
+		},
+		{
+			rule: "AWS-S3-001",
+			name: "bucket with default encryption",
+			setup: func(f *fakeClients) {
+				f.s3.addBucket("encrypted")
+				f.s3.encryption["encrypted"] = &s3.ServerSideEncryptionConfiguration{}
+			},
+			want: []wantResult{{StatusCompliant, "encrypted"}},
+		},
+		{
+			rule: "AWS-S3-001",
+			name: "bucket without default encryption",
+			setup: func(f *fakeClients) {
+				f.s3.addBucket("plain")
+			},
+			want: []wantResult{{StatusNonCompliant, "plain"}},
+		},
+		{
+			rule: "AWS-S3-001",
+			name: "bucket encryption cannot be fetched",
+			setup: func(f *fakeClients) {
+				f.s3.addBucket("plain")
+				f.fail("GetBucketEncryption")
+			},
+			want: []wantResult{{StatusError, "plain"}},
+		},
+		{
+			rule: "AWS-VPC-001",
+			name: "VPC with flow logs",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.ec2.addFlowLog("vpc-1")
+			},
+			want: []wantResult{{StatusCompliant, "vpc-1"}},
+		},
+		{
+			rule: "AWS-VPC-001",
+			name: "VPC without flow logs",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.ec2.addFlowLog("vpc-1")
+				f.ec2.addVPC("vpc-2")
+			},
+			want: []wantResult{{StatusCompliant, "vpc-1"}, {StatusNonCompliant, "vpc-2"}},
+		},
+		{
+			rule: "AWS-VPC-001",
+			name: "flow logs cannot be listed",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.fail("DescribeFlowLogs")
+			},
+			want: []wantResult{{StatusError, "vpc-1"}},
+		},
+		{
+			rule: "AWS-VPC-002",
+			name: "default security group without rules",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.ec2.addSecurityGroup("vpc-1", "sg-default", "default")
+				f.ec2.addSecurityGroup("vpc-1", "sg-web", "web", sshFrom("0.0.0.0/0"))
+			},
+			want: []wantResult{{StatusCompliant, "sg-default"}},
+		},
+		{
+			rule: "AWS-VPC-002",
+			name: "default security group with rules",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.ec2.addSecurityGroup("vpc-1", "sg-default", "default", sshFrom("10.0.0.0/8"))
+			},
+			want: []wantResult{{StatusNonCompliant, "sg-default"}},
+		},
+		{
+			rule: "AWS-VPC-002",
+			name: "security groups cannot be listed",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.fail("DescribeSecurityGroups")
+			},
+			want: []wantResult{{StatusError, "vpc-1"}},
+		},
+		{
+			rule: "AWS-VPC-003",
+			name: "SSH from a private range",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.ec2.addSecurityGroup("vpc-1", "sg-ssh", "ssh", sshFrom("10.0.0.0/8"))
+			},
+			want: []wantResult{{StatusCompliant, "sg-ssh"}},
+		},
+		{
+			rule: "AWS-VPC-003",
+			name: "SSH from anywhere over IPv4 and IPv6",
+			setup: func(f *fakeClients) {
+				f.ec2.addVPC("vpc-1")
+				f.ec2.addSecurityGroup("vpc-1", "sg-ipv4", "ipv4", sshFrom("0.0.0.0/0"))
+				f.ec2.addSecurityGroup("vpc-1", "sg-ipv6", "ipv6", &ec2.IpPermission{
+					IpProtocol: aws.String("tcp"),
+					FromPort:   aws.Int64(0),
+					ToPort:     aws.Int64(65535),
+					Ipv6Ranges: []*ec2.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+				})
+				f.ec2.addSecurityGroup("vpc-1", "sg-https", "https", &ec2.IpPermission{
+					IpProtocol: aws.String("tcp"),
+					FromPort:   aws.Int64(443),
+					ToPort:     aws.Int64(443),
+					IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+				})
+			},
+			want: []wantResult{
+				{StatusNonCompliant, "sg-ipv4"},
+				{StatusNonCompliant, "sg-ipv6"},
+				{StatusCompliant, "sg-https"},
+			},
+		},
+		{
+			rule: "AWS-VPC-003",
+			name: "VPCs cannot be listed",
+			setup: func(f *fakeClients) {
+				f.fail("DescribeVpcs")
+			},
+			want: []wantResult{{StatusError, testRegion}},
+		},
+		{
+			rule: "AWS-CT-001",
+			name: "encrypted trail",
+			setup: func(f *fakeClients) {
+				f.cloudTrail.addTrail("main", true).KmsKeyId = aws.String("arn:aws:kms:us-east-1:111122223333:key/1")
+			},
+			want: []wantResult{{StatusCompliant, "main"}},
+		},
+		{
+			rule: "AWS-CT-001",
+			name: "unencrypted trail",
+			setup: func(f *fakeClients) {
+				f.cloudTrail.addTrail("main", true)
+			},
+			want: []wantResult{{StatusNonCompliant, "main"}},
+		},
+		{
+			rule: "AWS-CT-001",
+			name: "trails cannot be listed",
+			setup: func(f *fakeClients) {
+				f.fail("DescribeTrails")
+			},
+			want: []wantResult{{StatusError, testRegion}},
+		},
+		{
+			rule: "AWS-CT-002",
+			name: "multi-region trail logging management events",
+			setup: func(f *fakeClients) {
+				trail := f.cloudTrail.addTrail("main", true)
+				f.cloudTrail.selectors[aws.StringValue(trail.TrailARN)] = []*cloudtrail.EventSelector{{
+					IncludeManagementEvents: aws.Bool(true),
+					ReadWriteType:           aws.String(cloudtrail.ReadWriteTypeAll),
+				}}
+			},
+			want: []wantResult{{StatusCompliant, "main"}},
+		},
+		{
+			rule: "AWS-CT-002",
+			name: "only a single-region trail",
+			setup: func(f *fakeClients) {
+				f.cloudTrail.addTrail("regional", false)
+			},
+			want: []wantResult{{StatusNonCompliant, "N/A"}},
+		},
+		{
+			rule: "AWS-CT-002",
+			name: "event selectors cannot be fetched",
+			setup: func(f *fakeClients) {
+				f.cloudTrail.addTrail("main", true)
+				f.fail("GetEventSelectors")
+			},
+			want: []wantResult{{StatusError, "main"}},
+		},
+		{
+			rule: "AWS-CT-003",
+			name: "trail with log file validation",
+			setup: func(f *fakeClients) {
+				f.cloudTrail.addTrail("main", true).LogFileValidationEnabled = aws.Bool(true)
+			},
+			want: []wantResult{{StatusCompliant, "main"}},
+		},
+		{
+			rule: "AWS-CT-003",
+			name: "trail without log file validation",
+			setup: func(f *fakeClients) {
+				f.cloudTrail.addTrail("main", true)
+			},
+			want: []wantResult{{StatusNonCompliant, "main"}},
+		},
+		{
+			rule: "AWS-CT-003",
+			name: "trails cannot be listed",
+			setup: func(f *fakeClients) {
+				f.fail("DescribeTrails")
+			},
+			want: []wantResult{{StatusError, testRegion}},
+		},
+	}
+}
+
+func TestRules(t *testing.T) {
+	for _, tt := range ruleTests(time.Now()) {
+		t.Run(tt.rule+"/"+tt.name, func(t *testing.T) {
+			f := newFakeClients()
+			tt.setup(f)
+			ctx := context.Background()
+			a, err := newFakeAWS(ctx, f, tt.rule)
+			if err != nil {
+				t.Fatalf("NewAWSWithClients() error = %v", err)
+			}
+			res, err := a.Check(ctx)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			got := gotResults(res)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Check() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Check() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			for _, r := range res {
+				if r.RuleID != tt.rule {
+					t.Errorf("result of rule %s, want %s", r.RuleID, tt.rule)
+				}
+				if r.Status == StatusNonCompliant && (r.Remediation == nil || r.Remediation.Text == "") {
+					t.Errorf("finding of %s has no remediation", r.Resource.Name)
+				}
+			}
+		})
+	}
+}
+
+// TestRulesCovered checks that TestRules has a compliant, a non-compliant
+// and an error case of every registered rule
+func TestRulesCovered(t *testing.T) {
+	rules, err := SelectRules(RuleFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]map[Status]bool{}
+	for _, tt := range ruleTests(time.Now()) {
+		if statuses[tt.rule] == nil {
+			statuses[tt.rule] = map[Status]bool{}
+		}
+		for _, w := range tt.want {
+			statuses[tt.rule][w.status] = true
+		}
+	}
+	for _, r := range rules {
+		for _, status := range []Status{StatusCompliant, StatusNonCompliant, StatusError} {
+			if !statuses[r.ID][status] {
+				t.Errorf("rule %s has no %s test case", r.ID, status)
+			}
+		}
+	}
+}
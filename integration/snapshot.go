@@ -0,0 +1,70 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SnapshotVersion is the only supported snapshot format version
+const SnapshotVersion = 1
+
+// Snapshot is the inventory of every account of a scan. It is the raw
+// evidence rules are evaluated against, and can be saved and evaluated
+// offline.
+type Snapshot struct {
+	// Version is the snapshot format version and must be SnapshotVersion
+	Version int `json:"version"`
+	// CreatedAt is when collection finished
+	CreatedAt time.Time `json:"created_at"`
+	// Accounts are the inventories of the accounts checked, in the order
+	// their results are reported
+	Accounts []*Inventory `json:"accounts"`
+}
+
+// newSnapshot returns a Snapshot of the given inventories
+func newSnapshot(inventories []*Inventory) *Snapshot {
+	return &Snapshot{
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Accounts:  inventories,
+	}
+}
+
+// Write writes s to w as indented JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadSnapshot reads a snapshot written by Snapshot.Write. Unknown fields are
+// rejected, since they would be silently ignored by every rule.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the version first, so that a snapshot of another version fails
+	// with a clear error rather than on its first unknown field.
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, must be %d", header.Version, SnapshotVersion)
+	}
+
+	var s Snapshot
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
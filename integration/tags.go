@@ -0,0 +1,113 @@
+package integration
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// TagFilter scopes the scan to resources by their AWS tags. Tag values are
+// glob patterns, where * matches any sequence of characters, so a value of *
+// only requires the tag to be present.
+//
+// Only resources that can be tagged are scoped, e.g. not the root account.
+type TagFilter struct {
+	// Include, if set, selects only resources that have every one of these
+	// tags
+	Include map[string]string `yaml:"include" json:"include,omitempty"`
+	// Exclude excludes resources that have any of these tags
+	Exclude map[string]string `yaml:"exclude" json:"exclude,omitempty"`
+}
+
+// Validate checks that f has no empty tag keys
+func (f TagFilter) Validate() error {
+	for _, tags := range []map[string]string{f.Include, f.Exclude} {
+		for key := range tags {
+			if key == "" {
+				return errors.New("tag filter has an empty tag key")
+			}
+		}
+	}
+	return nil
+}
+
+// Match reports whether f selects a resource with the given tags
+func (f TagFilter) Match(tags map[string]string) bool {
+	for key, pattern := range f.Include {
+		value, ok := tags[key]
+		if !ok || !globMatch(pattern, value) {
+			return false
+		}
+	}
+	for key, pattern := range f.Exclude {
+		if value, ok := tags[key]; ok && globMatch(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterByTags drops the results of tagged resources that f does not select.
+// Results of resources that cannot be tagged, and errors that occurred before
+// a resource's tags were known, are always kept.
+func filterByTags(results []Result, f TagFilter) []Result {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return results
+	}
+
+	filtered := results[:0]
+	for _, res := range results {
+		if res.Resource.Tags == nil || f.Match(res.Resource.Tags) {
+			filtered = append(filtered, res)
+		}
+	}
+	return filtered
+}
+
+// withoutTags returns results with the tags of their resources removed, so
+// that filterByTags keeps them
+func withoutTags(results []Result) []Result {
+	for i := range results {
+		results[i].Resource.Tags = nil
+	}
+	return results
+}
+
+// The tag conversions below always return a non-nil map, which marks the
+// resource as taggable even if it has no tags.
+
+func ec2Tags(tags []*ec2.Tag) map[string]string {
+	m := map[string]string{}
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
+
+func iamTags(tags []*iam.Tag) map[string]string {
+	m := map[string]string{}
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
+
+func s3Tags(tags []*s3.Tag) map[string]string {
+	m := map[string]string{}
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
+
+func cloudTrailTags(tags []*cloudtrail.Tag) map[string]string {
+	m := map[string]string{}
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
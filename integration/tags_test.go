@@ -0,0 +1,186 @@
+package integration
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestTagFilterMatch(t *testing.T) {
+	tags := map[string]string{"team": "data", "env": "prod-eu"}
+	for _, tt := range []struct {
+		name   string
+		filter TagFilter
+		want   bool
+	}{
+		{name: "no filter", want: true},
+		{
+			name:   "included",
+			filter: TagFilter{Include: map[string]string{"team": "data"}},
+			want:   true,
+		},
+		{
+			name:   "included by every tag",
+			filter: TagFilter{Include: map[string]string{"team": "data", "env": "prod-*"}},
+			want:   true,
+		},
+		{
+			name:   "one included tag differs",
+			filter: TagFilter{Include: map[string]string{"team": "data", "env": "dev"}},
+		},
+		{
+			name:   "included tag missing",
+			filter: TagFilter{Include: map[string]string{"owner": "*"}},
+		},
+		{
+			name:   "included by any value",
+			filter: TagFilter{Include: map[string]string{"env": "*"}},
+			want:   true,
+		},
+		{
+			name:   "excluded",
+			filter: TagFilter{Exclude: map[string]string{"env": "prod-*"}},
+		},
+		{
+			name:   "excluded by any value",
+			filter: TagFilter{Exclude: map[string]string{"team": "*"}},
+		},
+		{
+			name:   "excluded tag differs",
+			filter: TagFilter{Exclude: map[string]string{"env": "dev-*"}},
+			want:   true,
+		},
+		{
+			name:   "excluded tag missing",
+			filter: TagFilter{Exclude: map[string]string{"owner": "*"}},
+			want:   true,
+		},
+		{
+			name: "included and excluded",
+			filter: TagFilter{
+				Include: map[string]string{"team": "data"},
+				Exclude: map[string]string{"env": "prod-eu"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tags); got != tt.want {
+				t.Errorf("Match(%v) = %v, want %v", tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterByTags(t *testing.T) {
+	inv := &Inventory{AccountID: testAccountID}
+	user := func(name string, tags ...string) IAMUser {
+		u := IAMUser{User: &iam.User{UserName: aws.String(name)}}
+		for i := 0; i < len(tags); i += 2 {
+			u.User.Tags = append(u.User.Tags, &iam.Tag{Key: aws.String(tags[i]), Value: aws.String(tags[i+1])})
+		}
+		return u
+	}
+	alice, bob := user("alice", "team", "data"), user("bob", "team", "web")
+	untagged := user("carol")
+	unknown := user("dave", "team", "data")
+	unknown.TagsError = "AccessDenied"
+	key := func(id string) IAMAccessKey {
+		return IAMAccessKey{Key: &iam.AccessKeyMetadata{AccessKeyId: aws.String(id)}}
+	}
+	results := func() []Result {
+		var res []Result
+		for _, r := range []Resource{
+			rootResource(inv),
+			userResource(inv, alice),
+			accessKeyResource(inv, alice, key("AKIAALICE")),
+			userResource(inv, bob),
+			accessKeyResource(inv, bob, key("AKIABOB")),
+			userResource(inv, untagged),
+			userResource(inv, unknown),
+		} {
+			res = append(res, newResult(r, false, ""))
+		}
+		return res
+	}
+
+	for _, tt := range []struct {
+		name   string
+		filter TagFilter
+		want   []string
+	}{
+		{
+			name: "no filter",
+			want: []string{"root", "alice", "AKIAALICE", "bob", "AKIABOB", "carol", "dave"},
+		},
+		{
+			name:   "include",
+			filter: TagFilter{Include: map[string]string{"team": "data"}},
+			want:   []string{"root", "alice", "AKIAALICE", "dave"},
+		},
+		{
+			name:   "include any value",
+			filter: TagFilter{Include: map[string]string{"team": "*"}},
+			want:   []string{"root", "alice", "AKIAALICE", "bob", "AKIABOB", "dave"},
+		},
+		{
+			name:   "exclude",
+			filter: TagFilter{Exclude: map[string]string{"team": "w*"}},
+			want:   []string{"root", "alice", "AKIAALICE", "carol", "dave"},
+		},
+		{
+			name:   "exclude any value",
+			filter: TagFilter{Exclude: map[string]string{"team": "*"}},
+			want:   []string{"root", "carol", "dave"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, res := range filterByTags(results(), tt.filter) {
+				got = append(got, res.Resource.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterByTags() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMultiRegionTrailTagFilter checks that an account keeps its
+// AWS-CT-002 result when the trail meeting it is filtered out by its tags
+func TestMultiRegionTrailTagFilter(t *testing.T) {
+	for _, filter := range []TagFilter{
+		{Exclude: map[string]string{"env": "dev"}},
+		{Include: map[string]string{"env": "prod"}},
+	} {
+		f := newFakeClients()
+		trail := f.cloudTrail.addTrail("dev", true)
+		trailARN := aws.StringValue(trail.TrailARN)
+		f.cloudTrail.tags[trailARN] = []*cloudtrail.Tag{{Key: aws.String("env"), Value: aws.String("dev")}}
+		f.cloudTrail.selectors[trailARN] = []*cloudtrail.EventSelector{{
+			IncludeManagementEvents: aws.Bool(true),
+			ReadWriteType:           aws.String(cloudtrail.ReadWriteTypeAll),
+		}}
+
+		ctx := context.Background()
+		a, err := NewAWSWithClients(ctx, f, Options{
+			Region:  testRegion,
+			Regions: []string{testRegion},
+			Filter:  RuleFilter{Rules: []string{"AWS-CT-002"}},
+			Tags:    filter,
+		})
+		if err != nil {
+			t.Fatalf("NewAWSWithClients() error = %v", err)
+		}
+		res, err := a.Check(ctx)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if got, want := gotResults(res), []wantResult{{StatusCompliant, "dev"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("with tag filter %+v, results = %v, want %v", filter, got, want)
+		}
+	}
+}
@@ -1,5 +1,13 @@
 package integration
 
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
 // concatSlice is a generic function that concatenates multiple slices of the
 // same type
 func concatSlice[T any](slices ...[]T) []T {
@@ -9,3 +17,39 @@ func concatSlice[T any](slices ...[]T) []T {
 	}
 	return result
 }
+
+// isErrorCode reports whether err is an AWS error with the given code
+func isErrorCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
+
+// contains reports whether s contains v
+func contains[T comparable](s []T, v T) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether s matches pattern, where * matches any sequence
+// of characters and ? matches any single character. Unlike path.Match, *
+// also matches /, which is needed to match ARNs.
+func globMatch(pattern, s string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString(s)
+}
@@ -0,0 +1,125 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Waiver accepts the risk of non-compliant results of matching rules and
+// resources until it expires
+type Waiver struct {
+	// Rule is a rule ID or glob pattern, e.g. AWS-VPC-*
+	Rule string `yaml:"rule" json:"rule"`
+	// Resource is a glob pattern matched against the resource name or ARN,
+	// where * matches any sequence of characters including /
+	Resource string `yaml:"resource" json:"resource"`
+	// Justification explains why the risk is accepted
+	Justification string `yaml:"justification" json:"justification"`
+	// Approver is who accepted the risk
+	Approver string `yaml:"approver" json:"approver"`
+	// Expires is when the waiver stops applying, e.g. 2024-06-30 for
+	// midnight UTC at the start of that day
+	Expires Date `yaml:"expires" json:"expires"`
+}
+
+// Date is a point in time written as a date such as 2024-06-30, or as an
+// RFC 3339 timestamp
+type Date struct {
+	time.Time
+}
+
+// UnmarshalYAML parses a date, quoted or not
+func (d *Date) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: expected a date such as 2024-06-30", node.Line)
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, node.Value); err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return &yaml.TypeError{Errors: []string{
+		fmt.Sprintf("line %d: invalid date %q, e.g. 2024-06-30", node.Line, node.Value),
+	}}
+}
+
+// Validate checks that w is complete and its patterns are well-formed
+func (w Waiver) Validate() error {
+	switch {
+	case w.Rule == "":
+		return errors.New("waiver has no rule")
+	case w.Resource == "":
+		return fmt.Errorf("waiver of %s has no resource", w.Rule)
+	case w.Justification == "":
+		return fmt.Errorf("waiver of %s for %s has no justification", w.Rule, w.Resource)
+	case w.Approver == "":
+		return fmt.Errorf("waiver of %s for %s has no approver", w.Rule, w.Resource)
+	case w.Expires.IsZero():
+		return fmt.Errorf("waiver of %s for %s has no expiry date", w.Rule, w.Resource)
+	}
+	if _, err := path.Match(w.Rule, ""); err != nil {
+		return fmt.Errorf("waiver has invalid rule pattern %q: %w", w.Rule, err)
+	}
+	return nil
+}
+
+// Matches reports whether w applies to res, ignoring expiry
+func (w Waiver) Matches(res Result) bool {
+	if ok, _ := path.Match(w.Rule, res.RuleID); !ok {
+		return false
+	}
+	return globMatch(w.Resource, res.Resource.Name) ||
+		(res.Resource.ARN != "" && globMatch(w.Resource, res.Resource.ARN))
+}
+
+// Expired reports whether w no longer applies at now
+func (w Waiver) Expired(now time.Time) bool {
+	return !now.Before(w.Expires.Time)
+}
+
+// applyWaivers marks every non-compliant result matched by an active waiver as
+// waived. Results matched only by expired waivers stay non-compliant, with
+// the expiry noted in their reason.
+func applyWaivers(results []Result, waivers []Waiver, now time.Time) []Result {
+	for i, res := range results {
+		if res.Status != StatusNonCompliant {
+			continue
+		}
+
+		var expired *Waiver
+		for j, w := range waivers {
+			if !w.Matches(res) {
+				continue
+			}
+			if w.Expired(now) {
+				expired = &waivers[j]
+				continue
+			}
+			results[i].Status = StatusWaived
+			results[i].Waiver = &waivers[j]
+			expired = nil
+			break
+		}
+		if expired != nil {
+			results[i].Reason = fmt.Sprintf("%s (waiver approved by %s expired on %s)",
+				res.Reason, expired.Approver, expired.Expires.Format(time.DateOnly))
+		}
+	}
+	return results
+}
+
+// activeWaivers returns the waivers that have not expired at now
+func activeWaivers(waivers []Waiver, now time.Time) []Waiver {
+	active := []Waiver{}
+	for _, w := range waivers {
+		if !w.Expired(now) {
+			active = append(active, w)
+		}
+	}
+	return active
+}
@@ -0,0 +1,150 @@
+package integration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyWaivers(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	date := func(s string) Date {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Date{d}
+	}
+	waiver := func(rule, resource, expires string) Waiver {
+		return Waiver{
+			Rule:          rule,
+			Resource:      resource,
+			Justification: "accepted",
+			Approver:      "security@example.com",
+			Expires:       date(expires),
+		}
+	}
+	bucket := func(name string, status Status) Result {
+		return Result{
+			Resource: Resource{Type: "aws/s3-bucket", Name: name, ARN: "arn:aws:s3:::" + name, AccountID: testAccountID},
+			RuleID:   "AWS-S3-001",
+			Status:   status,
+			Reason:   "Bucket has no default encryption",
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		waivers []Waiver
+		res     Result
+		// wantStatus and wantReason are those of res once waivers are applied
+		wantStatus Status
+		wantReason string
+		// wantWaiver is the index of the waiver applied, if any
+		wantWaiver int
+	}{
+		{
+			name:       "active waiver",
+			waivers:    []Waiver{waiver("AWS-S3-001", "logs", "2024-07-01")},
+			res:        bucket("logs", StatusNonCompliant),
+			wantStatus: StatusWaived,
+			wantReason: "Bucket has no default encryption",
+		},
+		{
+			name:       "expired waiver",
+			waivers:    []Waiver{waiver("AWS-S3-001", "logs", "2024-06-01")},
+			res:        bucket("logs", StatusNonCompliant),
+			wantStatus: StatusNonCompliant,
+			wantReason: "Bucket has no default encryption (waiver approved by security@example.com expired on 2024-06-01)",
+			wantWaiver: -1,
+		},
+		{
+			name:       "expiring at the start of the day",
+			waivers:    []Waiver{waiver("AWS-S3-001", "logs", "2024-06-15")},
+			res:        bucket("logs", StatusNonCompliant),
+			wantStatus: StatusNonCompliant,
+			wantReason: "Bucket has no default encryption (waiver approved by security@example.com expired on 2024-06-15)",
+			wantWaiver: -1,
+		},
+		{
+			name: "active waiver after an expired one",
+			waivers: []Waiver{
+				waiver("AWS-S3-001", "logs", "2024-06-01"),
+				waiver("AWS-S3-*", "logs", "2025-01-01"),
+			},
+			res:        bucket("logs", StatusNonCompliant),
+			wantStatus: StatusWaived,
+			wantReason: "Bucket has no default encryption",
+			wantWaiver: 1,
+		},
+		{
+			name:       "ARN glob",
+			waivers:    []Waiver{waiver("AWS-S3-001", "arn:aws:s3:::log*", "2024-07-01")},
+			res:        bucket("logs-eu", StatusNonCompliant),
+			wantStatus: StatusWaived,
+			wantReason: "Bucket has no default encryption",
+		},
+		{
+			name:       "other resource",
+			waivers:    []Waiver{waiver("AWS-S3-001", "arn:aws:s3:::log*", "2024-07-01")},
+			res:        bucket("data", StatusNonCompliant),
+			wantStatus: StatusNonCompliant,
+			wantReason: "Bucket has no default encryption",
+			wantWaiver: -1,
+		},
+		{
+			name:       "other rule",
+			waivers:    []Waiver{waiver("AWS-VPC-*", "*", "2024-07-01")},
+			res:        bucket("logs", StatusNonCompliant),
+			wantStatus: StatusNonCompliant,
+			wantReason: "Bucket has no default encryption",
+			wantWaiver: -1,
+		},
+		{
+			name:       "error",
+			waivers:    []Waiver{waiver("AWS-S3-001", "logs", "2024-07-01")},
+			res:        bucket("logs", StatusError),
+			wantStatus: StatusError,
+			wantReason: "Bucket has no default encryption",
+			wantWaiver: -1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyWaivers([]Result{tt.res}, tt.waivers, now)[0]
+			if got.Status != tt.wantStatus || got.Reason != tt.wantReason {
+				t.Errorf("result = %s (%s), want %s (%s)", got.Status, got.Reason, tt.wantStatus, tt.wantReason)
+			}
+			var want *Waiver
+			if tt.wantWaiver >= 0 {
+				want = &tt.waivers[tt.wantWaiver]
+			}
+			if got.Waiver != want {
+				t.Errorf("waiver = %+v, want %+v", got.Waiver, want)
+			}
+		})
+	}
+}
+
+func TestActiveWaivers(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	waiver := func(resource string, expires time.Time) Waiver {
+		return Waiver{Rule: "AWS-S3-001", Resource: resource, Expires: Date{expires}}
+	}
+	waivers := []Waiver{
+		waiver("expired", now.AddDate(0, 0, -1)),
+		waiver("expiring", now),
+		waiver("active", now.AddDate(0, 0, 1)),
+	}
+	if got, want := activeWaivers(waivers, now), waivers[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("activeWaivers() = %+v, want %+v", got, want)
+	}
+
+	// Reports list the waivers active at the time of the scan.
+	waivers = []Waiver{
+		waiver("expired", time.Now().AddDate(-1, 0, 0)),
+		waiver("active", time.Now().AddDate(1, 0, 0)),
+	}
+	if got, want := NewReport(nil, waivers).Waivers, waivers[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("report waivers = %+v, want %+v", got, want)
+	}
+}
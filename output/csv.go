@@ -0,0 +1,55 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func init() {
+	Register("csv", FormatterFunc(formatCSV))
+}
+
+// formatCSV writes one row per result
+func formatCSV(w io.Writer, r *integration.Report) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{
+		"rule_id", "rule", "service", "severity", "criteria",
+		"resource_type", "resource_name", "resource_arn", "account_id", "region", "status", "reason",
+		"remediation", "remediation_cli",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, res := range r.Results {
+		var remediation, remediationCLI string
+		if res.Remediation != nil {
+			remediation, remediationCLI = res.Remediation.Text, res.Remediation.CLI
+		}
+		err := cw.Write([]string{
+			res.RuleID,
+			res.Rule,
+			res.Service,
+			string(res.Severity),
+			strings.Join(res.Criteria, " "),
+			res.Resource.Type,
+			res.Resource.Name,
+			res.Resource.ARN,
+			res.Resource.AccountID,
+			res.Resource.Region,
+			string(res.Status),
+			res.Reason,
+			remediation,
+			remediationCLI,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,142 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// DiffFormats are the formats a diff can be written in
+var DiffFormats = []string{"text", "markdown", "json"}
+
+// FormatDiff writes d to w in format, one of DiffFormats
+func FormatDiff(w io.Writer, format string, d *integration.Diff) error {
+	switch format {
+	case "text":
+		return formatDiffText(w, d)
+	case "markdown":
+		return formatDiffMarkdown(w, d)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	default:
+		return fmt.Errorf("unknown diff format %q, must be one of %v", format, DiffFormats)
+	}
+}
+
+// diffSummary summarizes d in a sentence
+func diffSummary(d *integration.Diff) string {
+	return fmt.Sprintf("%d new findings, %d fixed, %d persisting; %d resources appeared, %d disappeared.",
+		len(d.NewFindings), len(d.FixedFindings), len(d.PersistingFindings),
+		len(d.AppearedResources), len(d.DisappearedResources))
+}
+
+// formatPassRate formats r as passed/checked and a percentage, or "-" if
+// the rule was not checked
+func formatPassRate(r *integration.PassRate) string {
+	if r == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", r.Passed, r.Checked, 100*r.Rate)
+}
+
+// formatDiffText writes d as aligned tables
+func formatDiffText(w io.Writer, d *integration.Diff) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, diffSummary(d))
+
+	tw := tabwriter.NewWriter(bw, 0, 4, 2, ' ', 0)
+	findings := func(title string, results []integration.Result) {
+		if len(results) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\n\nRULE\tSEVERITY\tRESOURCE\tREASON\n", title)
+		for _, res := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.RuleID, res.Severity, res.Resource.ID(), res.Reason)
+		}
+		tw.Flush()
+	}
+	resources := func(title string, resources []integration.Resource) {
+		if len(resources) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\n\nTYPE\tRESOURCE\n", title)
+		for _, r := range resources {
+			fmt.Fprintf(tw, "%s\t%s\n", r.Type, r.ID())
+		}
+		tw.Flush()
+	}
+
+	findings("New findings", d.NewFindings)
+	findings("Fixed findings", d.FixedFindings)
+	findings("Persisting findings", d.PersistingFindings)
+	resources("Appeared resources", d.AppearedResources)
+	resources("Disappeared resources", d.DisappearedResources)
+	if len(d.Rules) > 0 {
+		fmt.Fprintf(tw, "\nPass rate changes\n\nRULE\tBASE\tHEAD\n")
+		for _, r := range d.Rules {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.RuleID, formatPassRate(r.Base), formatPassRate(r.Head))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// formatDiffMarkdown writes d as Markdown, e.g. for a pull request comment
+func formatDiffMarkdown(w io.Writer, d *integration.Diff) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# plio diff\n\n%s\n", diffSummary(d))
+
+	findings := func(title string, results []integration.Result) {
+		if len(results) == 0 {
+			return
+		}
+		fmt.Fprintf(bw, "\n## %s\n\n", title)
+		fmt.Fprintf(bw, "| Rule | Severity | Resource | Account | Region | Reason |\n")
+		fmt.Fprintf(bw, "| --- | --- | --- | --- | --- | --- |\n")
+		for _, res := range results {
+			fmt.Fprintf(bw, "| %s | %s | %s | %s | %s | %s |\n",
+				res.RuleID,
+				res.Severity,
+				markdownEscape(res.Resource.Name),
+				res.Resource.AccountID,
+				res.Resource.Region,
+				markdownEscape(res.Reason),
+			)
+		}
+	}
+	resources := func(title string, resources []integration.Resource) {
+		if len(resources) == 0 {
+			return
+		}
+		fmt.Fprintf(bw, "\n## %s\n\n", title)
+		fmt.Fprintf(bw, "| Resource | Type | Account | Region |\n")
+		fmt.Fprintf(bw, "| --- | --- | --- | --- |\n")
+		for _, r := range resources {
+			fmt.Fprintf(bw, "| %s | %s | %s | %s |\n",
+				markdownEscape(r.Name), markdownEscape(r.Type), r.AccountID, r.Region)
+		}
+	}
+
+	findings("❌ New findings", d.NewFindings)
+	findings("✅ Fixed findings", d.FixedFindings)
+	findings("Persisting findings", d.PersistingFindings)
+	resources("Appeared resources", d.AppearedResources)
+	resources("Disappeared resources", d.DisappearedResources)
+	if len(d.Rules) > 0 {
+		fmt.Fprintf(bw, "\n## Pass rate changes\n\n")
+		fmt.Fprintf(bw, "| Rule | Base | Head |\n")
+		fmt.Fprintf(bw, "| --- | --- | --- |\n")
+		for _, r := range d.Rules {
+			fmt.Fprintf(bw, "| %s | %s | %s |\n", r.RuleID, formatPassRate(r.Base), formatPassRate(r.Head))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,114 @@
+package output
+
+import (
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func init() {
+	Register("html", FormatterFunc(formatHTML))
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join":     strings.Join,
+	"location": resourceLocation,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>plio report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; }
+th { background: #f6f8fa; }
+.compliant { color: #1a7f37; }
+.non_compliant { color: #cf222e; font-weight: bold; }
+.error { color: #9a6700; font-weight: bold; }
+.waived { color: #57606a; font-style: italic; }
+.meta { color: #57606a; }
+details > summary { cursor: pointer; font-size: 1.1em; margin: 0.5em 0; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>plio report</h1>
+<table>
+<tr><th>Total</th><th>Compliant</th><th>Non-compliant</th><th>Waived</th><th>Errors</th></tr>
+<tr><td>{{.Summary.Total}}</td><td class="compliant">{{.Summary.Compliant}}</td><td class="non_compliant">{{.Summary.NonCompliant}}</td><td class="waived">{{.Summary.Waived}}</td><td class="error">{{.Summary.Errors}}</td></tr>
+</table>
+{{if gt (len .Accounts) 1}}
+<h2>Accounts</h2>
+<table>
+<tr><th>Account</th><th>Total</th><th>Compliant</th><th>Non-compliant</th><th>Waived</th><th>Errors</th></tr>
+{{range .Accounts}}<tr><td>{{.AccountID}}</td><td>{{.Total}}</td><td class="compliant">{{.Compliant}}</td><td class="non_compliant">{{.NonCompliant}}</td><td class="waived">{{.Waived}}</td><td class="error">{{.Errors}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Services}}
+<h2>{{.Service}}</h2>
+{{range .Rules}}
+<details{{if not .Passed}} open{{end}}>
+<summary><span class="{{if .Passed}}compliant{{else}}non_compliant{{end}}">{{if .Passed}}&#10004;{{else}}&#10008;{{end}}</span> {{.ID}}: {{.Title}}</summary>
+<p class="meta">Severity: {{.Severity}}, SOC2 criteria: {{join .Criteria ", "}}</p>
+<table>
+<tr><th>Resource</th><th>Type</th><th>Account</th><th>Region</th><th>Status</th><th>Reason</th></tr>
+{{range .Results}}<tr><td{{with .Resource.ARN}} title="{{.}}"{{end}}>{{.Resource.Name}}</td><td>{{.Resource.Type}}</td><td>{{.Resource.AccountID}}</td><td>{{.Resource.Region}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{with .Findings}}<h4>Remediation</h4>
+{{range .}}<p><strong>{{.Resource.Name}}</strong> ({{location .Resource}}): {{.Remediation.Text}}</p>
+{{with .Remediation.CLI}}<p class="meta">AWS CLI</p><pre><code>{{.}}</code></pre>
+{{end}}{{with .Remediation.Terraform}}<p class="meta">Terraform</p><pre><code>{{.}}</code></pre>
+{{end}}{{with .Remediation.CloudFormation}}<p class="meta">CloudFormation</p><pre><code>{{.}}</code></pre>
+{{end}}{{end}}{{end}}</details>
+{{end}}
+{{end}}
+{{with .Waivers}}
+<h2>Active waivers</h2>
+<table>
+<tr><th>Rule</th><th>Resource</th><th>Justification</th><th>Approver</th><th>Expires</th></tr>
+{{range .}}<tr><td>{{.Rule}}</td><td>{{.Resource}}</td><td>{{.Justification}}</td><td>{{.Approver}}</td><td>{{.Expires.Format "2006-01-02"}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// htmlRule is a ruleGroup with its pass state and findings precomputed for
+// the template
+type htmlRule struct {
+	ruleGroup
+	Passed   bool
+	Findings []integration.Result
+}
+
+type htmlService struct {
+	Service string
+	Rules   []htmlRule
+}
+
+// formatHTML writes a self-contained HTML report grouped by service and rule
+func formatHTML(w io.Writer, r *integration.Report) error {
+	var services []htmlService
+	for _, sg := range groupResults(r.Results) {
+		hs := htmlService{Service: sg.Service}
+		for _, rg := range sg.Rules {
+			hs.Rules = append(hs.Rules, htmlRule{ruleGroup: rg, Passed: rg.passed(), Findings: rg.findings()})
+		}
+		services = append(services, hs)
+	}
+
+	return htmlTemplate.Execute(w, struct {
+		Summary  integration.Summary
+		Accounts []integration.AccountSummary
+		Services []htmlService
+		Waivers  []integration.Waiver
+	}{
+		Summary:  r.Summary,
+		Accounts: r.Accounts,
+		Services: services,
+		Waivers:  r.Waivers,
+	})
+}
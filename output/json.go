@@ -0,0 +1,31 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func init() {
+	Register("json", FormatterFunc(formatJSON))
+	Register("ndjson", FormatterFunc(formatNDJSON))
+}
+
+// formatJSON writes the whole report as indented JSON
+func formatJSON(w io.Writer, r *integration.Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// formatNDJSON writes one JSON result per line
+func formatNDJSON(w io.Writer, r *integration.Report) error {
+	enc := json.NewEncoder(w)
+	for _, res := range r.Results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
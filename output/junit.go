@@ -0,0 +1,105 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func init() {
+	Register("junit", FormatterFunc(formatJUnit))
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// formatJUnit writes a JUnit XML report with one test suite per service and
+// one test case per rule. A rule fails if any resource is non-compliant.
+func formatJUnit(w io.Writer, r *integration.Report) error {
+	suites := junitTestSuites{Name: "plio"}
+	for _, sg := range groupResults(r.Results) {
+		suite := junitTestSuite{Name: sg.Service}
+		for _, rg := range sg.Rules {
+			tc := junitTestCase{
+				Name:      fmt.Sprintf("%s: %s", rg.ID, rg.Title),
+				ClassName: "plio." + sg.Service,
+			}
+
+			var failures, errors []string
+			for _, res := range rg.Results {
+				line := fmt.Sprintf("%s %s: %s", res.Resource.Type, res.Resource.Name, res.Reason)
+				switch res.Status {
+				case integration.StatusNonCompliant:
+					if res.Remediation != nil && res.Remediation.CLI != "" {
+						line += "\n  fix: " + strings.ReplaceAll(res.Remediation.CLI, "\n", "\n  fix: ")
+					}
+					failures = append(failures, line)
+				case integration.StatusError:
+					errors = append(errors, line)
+				}
+			}
+			if len(failures) > 0 {
+				tc.Failure = &junitMessage{
+					Message: fmt.Sprintf("%d non-compliant resources", len(failures)),
+					Text:    strings.Join(failures, "\n"),
+				}
+				suite.Failures++
+			}
+			if len(errors) > 0 {
+				tc.Error = &junitMessage{
+					Message: fmt.Sprintf("%d resources could not be checked", len(errors)),
+					Text:    strings.Join(errors, "\n"),
+				}
+				suite.Errors++
+			}
+
+			suite.Tests++
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,112 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func init() {
+	Register("markdown", FormatterFunc(formatMarkdown))
+}
+
+// formatMarkdown writes a Markdown report grouped by service and rule
+func formatMarkdown(w io.Writer, r *integration.Report) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# plio report\n\n")
+	fmt.Fprintf(bw, "| Total | Compliant | Non-compliant | Waived | Errors |\n")
+	fmt.Fprintf(bw, "| --- | --- | --- | --- | --- |\n")
+	fmt.Fprintf(bw, "| %d | %d | %d | %d | %d |\n",
+		r.Summary.Total, r.Summary.Compliant, r.Summary.NonCompliant, r.Summary.Waived, r.Summary.Errors)
+
+	if len(r.Accounts) > 1 {
+		fmt.Fprintf(bw, "\n## Accounts\n\n")
+		fmt.Fprintf(bw, "| Account | Total | Compliant | Non-compliant | Waived | Errors |\n")
+		fmt.Fprintf(bw, "| --- | --- | --- | --- | --- | --- |\n")
+		for _, a := range r.Accounts {
+			fmt.Fprintf(bw, "| %s | %d | %d | %d | %d | %d |\n",
+				a.AccountID, a.Total, a.Compliant, a.NonCompliant, a.Waived, a.Errors)
+		}
+	}
+
+	for _, sg := range groupResults(r.Results) {
+		fmt.Fprintf(bw, "\n## %s\n", sg.Service)
+		for _, rg := range sg.Rules {
+			mark := "✅"
+			if !rg.passed() {
+				mark = "❌"
+			}
+			fmt.Fprintf(bw, "\n### %s %s: %s\n\n", mark, rg.ID, markdownEscape(rg.Title))
+			fmt.Fprintf(bw, "Severity: %s, SOC2 criteria: %s\n\n", rg.Severity, strings.Join(rg.Criteria, ", "))
+			fmt.Fprintf(bw, "| Resource | Type | Account | Region | Status | Reason |\n")
+			fmt.Fprintf(bw, "| --- | --- | --- | --- | --- | --- |\n")
+			for _, res := range rg.Results {
+				fmt.Fprintf(bw, "| %s | %s | %s | %s | %s | %s |\n",
+					markdownEscape(res.Resource.Name),
+					markdownEscape(res.Resource.Type),
+					res.Resource.AccountID,
+					res.Resource.Region,
+					res.Status,
+					markdownEscape(res.Reason),
+				)
+			}
+			writeMarkdownRemediations(bw, rg.findings())
+		}
+	}
+
+	if len(r.Waivers) > 0 {
+		fmt.Fprintf(bw, "\n## Active waivers\n\n")
+		fmt.Fprintf(bw, "| Rule | Resource | Justification | Approver | Expires |\n")
+		fmt.Fprintf(bw, "| --- | --- | --- | --- | --- |\n")
+		for _, wv := range r.Waivers {
+			fmt.Fprintf(bw, "| %s | %s | %s | %s | %s |\n",
+				markdownEscape(wv.Rule),
+				markdownEscape(wv.Resource),
+				markdownEscape(wv.Justification),
+				markdownEscape(wv.Approver),
+				wv.Expires.Format(time.DateOnly),
+			)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeMarkdownRemediations writes how to fix every finding, with its
+// snippets as code blocks
+func writeMarkdownRemediations(w io.Writer, findings []integration.Result) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n#### Remediation\n")
+	for _, res := range findings {
+		rem := res.Remediation
+		fmt.Fprintf(w, "\n**%s** (%s): %s\n", markdownEscape(res.Resource.Name), resourceLocation(res.Resource), rem.Text)
+		for _, snippet := range []struct{ title, lang, code string }{
+			{"AWS CLI", "sh", rem.CLI},
+			{"Terraform", "hcl", rem.Terraform},
+			{"CloudFormation", "yaml", rem.CloudFormation},
+		} {
+			if snippet.code == "" {
+				continue
+			}
+			fmt.Fprintf(w, "\n%s:\n\n```%s\n%s\n```\n", snippet.title, snippet.lang, strings.TrimSuffix(snippet.code, "\n"))
+		}
+	}
+}
+
+// markdownEscape escapes s for use in a Markdown table cell
+func markdownEscape(s string) string {
+	return strings.NewReplacer(
+		"|", `\|`,
+		"\n", " ",
+		"*", `\*`,
+		"_", `\_`,
+		"`", "\\`",
+	).Replace(s)
+}
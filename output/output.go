@@ -0,0 +1,134 @@
+// Package output writes plio reports in various formats
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// Formatter writes a report in a particular format
+type Formatter interface {
+	Format(w io.Writer, r *integration.Report) error
+}
+
+// FormatterFunc adapts a function to a Formatter
+type FormatterFunc func(w io.Writer, r *integration.Report) error
+
+// Format calls f(w, r)
+func (f FormatterFunc) Format(w io.Writer, r *integration.Report) error {
+	return f(w, r)
+}
+
+var formatters = map[string]Formatter{}
+
+// Register makes a formatter available under name. Register panics if a
+// formatter with the same name has already been registered.
+func Register(name string, f Formatter) {
+	if _, ok := formatters[name]; ok {
+		panic(fmt.Sprintf("formatter %s registered twice", name))
+	}
+	formatters[name] = f
+}
+
+// Lookup returns the formatter registered under name
+func Lookup(name string) (Formatter, error) {
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q, must be one of %v", name, Names())
+	}
+	return f, nil
+}
+
+// Names returns the names of every registered formatter in sorted order
+func Names() []string {
+	var names []string
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceGroup holds the results of one service, grouped by rule
+type serviceGroup struct {
+	Service string
+	Rules   []ruleGroup
+}
+
+// ruleGroup holds the results of one rule
+type ruleGroup struct {
+	ID       string
+	Title    string
+	Severity integration.Severity
+	Criteria []string
+	Results  []integration.Result
+}
+
+// passed reports whether no result of the rule is non-compliant or an error
+func (g ruleGroup) passed() bool {
+	for _, res := range g.Results {
+		if res.Status == integration.StatusNonCompliant || res.Status == integration.StatusError {
+			return false
+		}
+	}
+	return true
+}
+
+// findings returns the non-compliant results of the rule, which are the ones
+// with a remediation to report
+func (g ruleGroup) findings() []integration.Result {
+	var res []integration.Result
+	for _, r := range g.Results {
+		if r.Status == integration.StatusNonCompliant && r.Remediation != nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// resourceLocation returns the account and region of r, e.g. to tell apart
+// resources of the same name in several accounts
+func resourceLocation(r integration.Resource) string {
+	var parts []string
+	for _, part := range []string{r.AccountID, r.Region} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// groupResults groups results by service and rule, in the order they first
+// appear in results
+func groupResults(results []integration.Result) []serviceGroup {
+	var groups []serviceGroup
+	serviceIdx := map[string]int{}
+	ruleIdx := map[string]int{}
+	for _, res := range results {
+		si, ok := serviceIdx[res.Service]
+		if !ok {
+			si = len(groups)
+			serviceIdx[res.Service] = si
+			groups = append(groups, serviceGroup{Service: res.Service})
+		}
+
+		g := &groups[si]
+		ri, ok := ruleIdx[res.RuleID]
+		if !ok {
+			ri = len(g.Rules)
+			ruleIdx[res.RuleID] = ri
+			g.Rules = append(g.Rules, ruleGroup{
+				ID:       res.RuleID,
+				Title:    res.Rule,
+				Severity: res.Severity,
+				Criteria: res.Criteria,
+			})
+		}
+		g.Rules[ri].Results = append(g.Rules[ri].Results, res)
+	}
+	return groups
+}
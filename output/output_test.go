@@ -0,0 +1,264 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+// testReport returns a report of an open security group in two accounts, an
+// unencrypted bucket with a remediation, a compliant root account and a
+// bucket that could not be checked
+func testReport() *integration.Report {
+	sg := func(account string) integration.Result {
+		return integration.Result{
+			Resource: integration.Resource{
+				Type:      "aws/security-group",
+				Name:      "default",
+				AccountID: account,
+				Region:    "us-east-1",
+			},
+			RuleID:   "AWS-VPC-003",
+			Rule:     "Security groups must not allow SSH from anywhere",
+			Service:  "vpc",
+			Severity: integration.SeverityHigh,
+			Criteria: []string{"CC6.6"},
+			Status:   integration.StatusNonCompliant,
+			Reason:   "SSH is open to 0.0.0.0/0",
+		}
+	}
+	bucket := func(name string) integration.Result {
+		return integration.Result{
+			Resource: integration.Resource{
+				Type:      "aws/s3-bucket",
+				Name:      name,
+				ARN:       "arn:aws:s3:::" + name,
+				AccountID: "111122223333",
+				Region:    "eu-west-1",
+			},
+			RuleID:   "AWS-S3-001",
+			Rule:     "S3 buckets must have default encryption",
+			Service:  "s3",
+			Severity: integration.SeverityMedium,
+			Criteria: []string{"CC6.1", "CC6.7"},
+		}
+	}
+
+	unencrypted := bucket("logs")
+	unencrypted.Status = integration.StatusNonCompliant
+	unencrypted.Reason = "Bucket has no default encryption"
+	unencrypted.Remediation = &integration.Remediation{
+		Text: "Enable default encryption.",
+		CLI:  "aws s3api put-bucket-encryption --bucket logs",
+	}
+	unchecked := bucket("data")
+	unchecked.Status = integration.StatusError
+	unchecked.Reason = "AccessDenied"
+
+	return integration.NewReport([]integration.Result{
+		sg("111122223333"),
+		sg("222233334444"),
+		unencrypted,
+		{
+			Resource: integration.Resource{
+				Type:      "aws/iam-user",
+				Name:      "root",
+				ARN:       "arn:aws:iam::111122223333:root",
+				AccountID: "111122223333",
+			},
+			RuleID:    "AWS-IAM-003",
+			Rule:      "Root account must have MFA enabled",
+			Service:   "iam",
+			Severity:  integration.SeverityCritical,
+			Criteria:  []string{"CC6.1"},
+			Status:    integration.StatusCompliant,
+			Compliant: true,
+		},
+		unchecked,
+	}, nil)
+}
+
+// format writes testReport in the named format
+func format(t *testing.T, name string) []byte {
+	t.Helper()
+	f, err := Lookup(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.Format(&buf, testReport()); err != nil {
+		t.Fatalf("formatting %s: %v", name, err)
+	}
+	return buf.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"json", "ndjson", "csv", "junit", "sarif", "markdown", "html"} {
+		if _, err := Lookup(name); err != nil {
+			t.Errorf("Lookup(%q) error = %v", name, err)
+		}
+	}
+	if _, err := Lookup("xml"); err == nil || !strings.Contains(err.Error(), strings.Join(Names(), " ")) {
+		t.Errorf("Lookup(%q) error = %v, want one listing %v", "xml", err, Names())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var got integration.Report
+	if err := json.Unmarshal(format(t, "json"), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := testReport()
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("JSON report = %+v, want %+v", got, want)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(format(t, "ndjson"))), "\n")
+	if len(lines) != len(want.Results) {
+		t.Fatalf("NDJSON report has %d lines, want %d", len(lines), len(want.Results))
+	}
+	for i, line := range lines {
+		var res integration.Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if !reflect.DeepEqual(res, want.Results[i]) {
+			t.Errorf("line %d = %+v, want %+v", i+1, res, want.Results[i])
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	rows, err := csv.NewReader(bytes.NewReader(format(t, "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{
+			"rule_id", "rule", "service", "severity", "criteria",
+			"resource_type", "resource_name", "resource_arn", "account_id", "region", "status", "reason",
+			"remediation", "remediation_cli",
+		},
+		{
+			"AWS-VPC-003", "Security groups must not allow SSH from anywhere", "vpc", "high", "CC6.6",
+			"aws/security-group", "default", "", "111122223333", "us-east-1", "non_compliant", "SSH is open to 0.0.0.0/0",
+			"", "",
+		},
+		{
+			"AWS-VPC-003", "Security groups must not allow SSH from anywhere", "vpc", "high", "CC6.6",
+			"aws/security-group", "default", "", "222233334444", "us-east-1", "non_compliant", "SSH is open to 0.0.0.0/0",
+			"", "",
+		},
+		{
+			"AWS-S3-001", "S3 buckets must have default encryption", "s3", "medium", "CC6.1 CC6.7",
+			"aws/s3-bucket", "logs", "arn:aws:s3:::logs", "111122223333", "eu-west-1", "non_compliant", "Bucket has no default encryption",
+			"Enable default encryption.", "aws s3api put-bucket-encryption --bucket logs",
+		},
+		{
+			"AWS-IAM-003", "Root account must have MFA enabled", "iam", "critical", "CC6.1",
+			"aws/iam-user", "root", "arn:aws:iam::111122223333:root", "111122223333", "", "compliant", "",
+			"", "",
+		},
+		{
+			"AWS-S3-001", "S3 buckets must have default encryption", "s3", "medium", "CC6.1 CC6.7",
+			"aws/s3-bucket", "data", "arn:aws:s3:::data", "111122223333", "eu-west-1", "error", "AccessDenied",
+			"", "",
+		},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("CSV rows = %q, want %q", rows, want)
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	var got junitTestSuites
+	if err := xml.Unmarshal(format(t, "junit"), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Tests != 3 || got.Failures != 2 || got.Errors != 1 {
+		t.Errorf("test suites count %d tests, %d failures and %d errors, want 3, 2 and 1",
+			got.Tests, got.Failures, got.Errors)
+	}
+	var suites []string
+	for _, s := range got.Suites {
+		suites = append(suites, s.Name)
+	}
+	if want := []string{"vpc", "s3", "iam"}; !reflect.DeepEqual(suites, want) {
+		t.Fatalf("test suites = %v, want %v", suites, want)
+	}
+
+	sg := got.Suites[0].TestCases[0]
+	if sg.Failure == nil || sg.Failure.Message != "2 non-compliant resources" {
+		t.Errorf("AWS-VPC-003 failure = %+v, want 2 non-compliant resources", sg.Failure)
+	}
+	s3 := got.Suites[1].TestCases[0]
+	if s3.Failure == nil || !strings.Contains(s3.Failure.Text, "fix: aws s3api put-bucket-encryption --bucket logs") {
+		t.Errorf("AWS-S3-001 failure = %+v, want one with the CLI fix", s3.Failure)
+	}
+	if s3.Error == nil || !strings.Contains(s3.Error.Text, "aws/s3-bucket data: AccessDenied") {
+		t.Errorf("AWS-S3-001 error = %+v, want the unchecked bucket", s3.Error)
+	}
+	if iam := got.Suites[2].TestCases[0]; iam.Failure != nil || iam.Error != nil {
+		t.Errorf("AWS-IAM-003 test case = %+v, want it to pass", iam)
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	var got sarifLog
+	if err := json.Unmarshal(format(t, "sarif"), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != sarifVersion || len(got.Runs) != 1 {
+		t.Fatalf("SARIF log has version %s and %d runs, want %s and 1", got.Version, len(got.Runs), sarifVersion)
+	}
+	run := got.Runs[0]
+
+	var rules []string
+	for _, r := range run.Tool.Driver.Rules {
+		rules = append(rules, r.ID)
+	}
+	if want := []string{"AWS-VPC-003", "AWS-S3-001", "AWS-IAM-003"}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %v, want %v", rules, want)
+	}
+
+	// Only non-compliant results are reported, each at a location unique
+	// to its resource.
+	type result struct {
+		ruleID    string
+		ruleIndex int
+		level     string
+		uri       string
+	}
+	var results []result
+	for _, r := range run.Results {
+		results = append(results, result{r.RuleID, r.RuleIndex, r.Level, r.Locations[0].PhysicalLocation.ArtifactLocation.URI})
+	}
+	want := []result{
+		{"AWS-VPC-003", 0, "error", "111122223333/us-east-1/aws/security-group/default"},
+		{"AWS-VPC-003", 0, "error", "222233334444/us-east-1/aws/security-group/default"},
+		{"AWS-S3-001", 1, "warning", "arn:aws:s3:::logs"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if props := run.Results[2].Properties; props == nil || props.Remediation == nil ||
+		props.Remediation.CLI != "aws s3api put-bucket-encryption --bucket logs" {
+		t.Errorf("AWS-S3-001 properties = %+v, want its remediation", props)
+	}
+
+	if len(run.Invocations) != 1 {
+		t.Fatalf("%d invocations, want 1", len(run.Invocations))
+	}
+	inv := run.Invocations[0]
+	if inv.ExecutionSuccessful || len(inv.ToolExecutionNotifications) != 1 ||
+		!strings.Contains(inv.ToolExecutionNotifications[0].Message.Text, "AccessDenied") {
+		t.Errorf("invocation = %+v, want it to have failed with the unchecked bucket", inv)
+	}
+}
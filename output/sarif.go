@@ -0,0 +1,199 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/S-Chan/plio/integration"
+)
+
+func init() {
+	Register("sarif", FormatterFunc(formatSARIF))
+}
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Results     []sarifResult     `json:"results"`
+	Invocations []sarifInvocation `json:"invocations"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	Name                 string              `json:"name"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration  `json:"defaultConfiguration"`
+	Properties           sarifRuleProperties `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProperties struct {
+	Tags     []string `json:"tags"`
+	Severity string   `json:"severity"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties *sarifResultProperties `json:"properties,omitempty"`
+}
+
+// sarifResultProperties holds what SARIF has no field for. SARIF fixes can
+// only describe changes to files.
+type sarifResultProperties struct {
+	Remediation *integration.Remediation `json:"remediation,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+// sarifLevel maps a rule severity to a SARIF result level
+func sarifLevel(s integration.Severity) string {
+	switch s {
+	case integration.SeverityCritical, integration.SeverityHigh:
+		return "error"
+	case integration.SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// formatSARIF writes a SARIF 2.1.0 log, e.g. for GitHub code scanning. Only
+// non-compliant results are reported as SARIF results; errors are reported as
+// tool execution notifications.
+func formatSARIF(w io.Writer, r *integration.Report) error {
+	driver := sarifDriver{
+		Name:           "plio",
+		InformationURI: "https://github.com/S-Chan/plio",
+		Rules:          []sarifRule{},
+	}
+	ruleIdx := map[string]int{}
+	for _, sg := range groupResults(r.Results) {
+		for _, rg := range sg.Rules {
+			ruleIdx[rg.ID] = len(driver.Rules)
+			driver.Rules = append(driver.Rules, sarifRule{
+				ID:                   rg.ID,
+				Name:                 rg.ID,
+				ShortDescription:     sarifMessage{Text: rg.Title},
+				DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rg.Severity)},
+				Properties: sarifRuleProperties{
+					Tags:     append([]string{"soc2", sg.Service}, rg.Criteria...),
+					Severity: string(rg.Severity),
+				},
+			})
+		}
+	}
+
+	results := []sarifResult{}
+	invocation := sarifInvocation{
+		ExecutionSuccessful:        !r.HasErrors(),
+		ToolExecutionNotifications: []sarifNotification{},
+	}
+	for _, res := range r.Results {
+		switch res.Status {
+		case integration.StatusNonCompliant:
+			var props *sarifResultProperties
+			if res.Remediation != nil {
+				props = &sarifResultProperties{Remediation: res.Remediation}
+			}
+			results = append(results, sarifResult{
+				RuleID:    res.RuleID,
+				RuleIndex: ruleIdx[res.RuleID],
+				Level:     sarifLevel(res.Severity),
+				Message:   sarifMessage{Text: res.Rule + ": " + res.Reason},
+				Locations: []sarifLocation{{
+					// Cloud resources have no file, so the resource stands
+					// in for one. Names are only unique within an account
+					// and region, so its ARN or ID is used.
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{
+							URI: res.Resource.ID(),
+						},
+					},
+					LogicalLocations: []sarifLogicalLocation{{
+						Name:               res.Resource.Name,
+						FullyQualifiedName: res.Resource.ARN,
+						Kind:               res.Resource.Type,
+					}},
+				}},
+				Properties: props,
+			})
+		case integration.StatusError:
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level: "error",
+				Message: sarifMessage{
+					Text: res.RuleID + " " + res.Resource.Type + "/" + res.Resource.Name + ": " + res.Reason,
+				},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool:        sarifTool{Driver: driver},
+			Results:     results,
+			Invocations: []sarifInvocation{invocation},
+		}},
+	})
+}